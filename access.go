@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// requestUserID returns the user making the request, or uuid.Nil for
+// anonymous requests. A bearer token that is present but invalid is an
+// error rather than being treated as anonymous.
+func (cfg *apiConfig) requestUserID(r *http.Request) (uuid.UUID, error) {
+	if r.Header.Get("Authorization") == "" {
+		return uuid.Nil, nil
+	}
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return auth.ValidateJWT(token, cfg.jwtSecret)
+}
+
+// canViewVideo reports whether userID, which is uuid.Nil for anonymous
+// requests, may see video.
+func canViewVideo(video database.Video, userID uuid.UUID) bool {
+	if video.Visibility != database.VideoVisibilityPrivate {
+		return true
+	}
+	return userID != uuid.Nil && userID == video.UserID
+}
+
+// authorizeVideoView loads the video in the request path and checks the
+// requester may see it, responding with an error and returning false if
+// not. Private videos of other users are reported as not found.
+func (cfg *apiConfig) authorizeVideoView(w http.ResponseWriter, r *http.Request) (database.Video, bool) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return database.Video{}, false
+	}
+
+	userID, err := cfg.requestUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return database.Video{}, false
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return database.Video{}, false
+	}
+	if video.ID == uuid.Nil || !canViewVideo(video, userID) {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return database.Video{}, false
+	}
+	return video, true
+}
+
+// signedStreamURL returns a link to the video's stream endpoint that works
+// without a bearer token until it expires, so players can load private
+// videos.
+func (cfg *apiConfig) signedStreamURL(videoID uuid.UUID) string {
+	expires := strconv.FormatInt(time.Now().Add(cfg.presignExpiry).Unix(), 10)
+	query := url.Values{
+		"expires":   {expires},
+		"signature": {cfg.streamSignature(videoID, expires)},
+	}
+	return fmt.Sprintf("/api/videos/%s/stream?%s", videoID, query.Encode())
+}
+
+// hasValidStreamSignature reports whether the request carries an unexpired
+// signature minted by signedStreamURL for videoID.
+func (cfg *apiConfig) hasValidStreamSignature(r *http.Request, videoID uuid.UUID) bool {
+	query := r.URL.Query()
+	return cfg.validVideoSignature("stream", videoID, query.Get("expires"), query.Get("signature"))
+}
+
+func (cfg *apiConfig) streamSignature(videoID uuid.UUID, expires string) string {
+	return cfg.videoSignature("stream", videoID, expires)
+}
+
+// signedAssetURL returns a link to one of the video's stored files that
+// works without a bearer token until it expires. The signature goes in the
+// path rather than the query, so URLs relative to it, like the segments
+// listed in an HLS playlist, are signed too.
+func (cfg *apiConfig) signedAssetURL(videoID uuid.UUID, key string) string {
+	expires := strconv.FormatInt(time.Now().Add(cfg.presignExpiry).Unix(), 10)
+	signature := cfg.videoSignature("assets", videoID, expires)
+	return fmt.Sprintf("/api/videos/%s/assets/%s/%s/%s", videoID, expires, signature, key)
+}
+
+// validVideoSignature reports whether signature was minted by
+// videoSignature for scope and videoID and hasn't expired.
+func (cfg *apiConfig) validVideoSignature(scope string, videoID uuid.UUID, expires, signature string) bool {
+	if expires == "" || signature == "" {
+		return false
+	}
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(cfg.videoSignature(scope, videoID, expires)))
+}
+
+func (cfg *apiConfig) videoSignature(scope string, videoID uuid.UUID, expires string) string {
+	mac := hmac.New(sha256.New, []byte(cfg.jwtSecret))
+	fmt.Fprintf(mac, "%s\n%s\n%s", scope, videoID, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -16,6 +16,19 @@ document.getElementById('video-draft-form').addEventListener('submit', async (ev
   await createVideoDraft();
 });
 
+document.getElementById('video-search-form').addEventListener('submit', async (event) => {
+  event.preventDefault();
+  await getVideos();
+});
+
+document.getElementById('video-sort').addEventListener('change', async () => {
+  await getVideos();
+});
+
+document.getElementById('load-more-button').addEventListener('click', async () => {
+  await getVideos(nextVideosCursor);
+});
+
 document.getElementById('login-form').addEventListener('submit', async (event) => {
   event.preventDefault();
   await login();
@@ -24,6 +37,7 @@ document.getElementById('login-form').addEventListener('submit', async (event) =
 async function createVideoDraft() {
   const title = document.getElementById('video-title').value;
   const description = document.getElementById('video-description').value;
+  const visibility = document.getElementById('video-visibility').value;
 
   try {
     const res = await fetch('/api/videos', {
@@ -32,7 +46,7 @@ async function createVideoDraft() {
         'Content-Type': 'application/json',
         Authorization: `Bearer ${localStorage.getItem('token')}`,
       },
-      body: JSON.stringify({ title, description }),
+      body: JSON.stringify({ title, description, visibility }),
     });
     const data = await res.json();
     if (!res.ok) {
@@ -175,7 +189,11 @@ async function uploadVideoFile(videoID) {
       throw new Error(`Failed to upload video file. Error: ${data.error}`);
     }
 
-    console.log('Video uploaded!');
+    const job = await res.json();
+    console.log('Video uploaded! Processing...');
+    document.getElementById(uploadBtnSelector).textContent = 'Processing...';
+    await waitForJob(job.id);
+    console.log('Video processed!');
     await getVideo(videoID);
   } catch (error) {
     alert(`Error: ${error.message}`);
@@ -184,11 +202,44 @@ async function uploadVideoFile(videoID) {
   setUploadButtonState(false, uploadBtnSelector);
 }
 
+async function waitForJob(jobID) {
+  while (true) {
+    const res = await fetch(`/api/jobs/${jobID}`, {
+      method: 'GET',
+      headers: {
+        Authorization: `Bearer ${localStorage.getItem('token')}`,
+      },
+    });
+    const job = await res.json();
+    if (!res.ok) {
+      throw new Error(`Failed to get processing status. Error: ${job.error}`);
+    }
+    if (job.status === 'succeeded') {
+      return job;
+    }
+    if (job.status === 'failed') {
+      throw new Error(`Video processing failed. Error: ${job.last_error}`);
+    }
+    await new Promise((resolve) => setTimeout(resolve, 2000));
+  }
+}
+
 const videoStateHandler = createVideoStateHandler();
 
-async function getVideos() {
+let nextVideosCursor = null;
+
+async function getVideos(cursor = null) {
+  const params = new URLSearchParams({ sort: document.getElementById('video-sort').value });
+  const search = document.getElementById('video-search').value.trim();
+  if (search) {
+    params.set('q', search);
+  }
+  if (cursor) {
+    params.set('cursor', cursor);
+  }
+
   try {
-    const res = await fetch('/api/videos', {
+    const res = await fetch(`/api/videos?${params}`, {
       method: 'GET',
       headers: {
         Authorization: `Bearer ${localStorage.getItem('token')}`,
@@ -199,20 +250,39 @@ async function getVideos() {
       throw new Error(`Failed to get videos. Error: ${data.error}`);
     }
 
-    const videos = await res.json();
+    const { videos, next_cursor } = await res.json();
     const videoList = document.getElementById('video-list');
-    videoList.innerHTML = '';
+    if (!cursor) {
+      videoList.innerHTML = '';
+    }
     for (const video of videos) {
       const listItem = document.createElement('li');
-      listItem.textContent = video.title;
+      listItem.textContent = video.status === 'ready' ? video.title : `${video.title} (${video.status})`;
+      if (video.media_info && video.media_info.duration_seconds != null) {
+        const badge = document.createElement('span');
+        badge.className = 'duration-badge';
+        badge.textContent = formatDuration(video.media_info.duration_seconds);
+        listItem.appendChild(badge);
+      }
       listItem.onclick = () => videoStateHandler(video.id);
       videoList.appendChild(listItem);
     }
+
+    nextVideosCursor = next_cursor;
+    document.getElementById('load-more-button').style.display = next_cursor ? 'inline-block' : 'none';
   } catch (error) {
     alert(`Error: ${error.message}`);
   }
 }
 
+function formatDuration(seconds) {
+  const total = Math.round(seconds);
+  const h = Math.floor(total / 3600);
+  const m = Math.floor((total % 3600) / 60);
+  const s = String(total % 60).padStart(2, '0');
+  return h > 0 ? `${h}:${String(m).padStart(2, '0')}:${s}` : `${m}:${s}`;
+}
+
 function createVideoStateHandler() {
   let currentVideoID = null;
 
@@ -254,9 +324,15 @@ function viewVideo(video) {
   currentVideo = video;
   document.getElementById('video-display').style.display = 'block';
   document.getElementById('video-title-display').textContent = video.title;
+  document.getElementById('video-status-display').textContent =
+    video.status_message ? `${video.status}: ${video.status_message}` : video.status;
   document.getElementById('video-description-display').textContent = video.description;
 
   const thumbnailImg = document.getElementById('thumbnail-image');
+  const thumbnailWebPSource = document.getElementById('thumbnail-webp-source');
+  const thumbnails = video.thumbnails || {};
+  thumbnailImg.srcset = toSrcset(thumbnails.jpeg);
+  thumbnailWebPSource.srcset = toSrcset(thumbnails.webp);
   if (!video.thumbnail_url) {
     thumbnailImg.style.display = 'none';
   } else {
@@ -276,6 +352,10 @@ function viewVideo(video) {
   }
 }
 
+function toSrcset(variants) {
+  return (variants || []).map((v) => `${v.url} ${v.width}w`).join(', ');
+}
+
 async function deleteVideo() {
   if (!currentVideo) {
     alert('No video selected for deletion.');
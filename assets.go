@@ -1,7 +1,17 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
 	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
 )
 
 func (cfg apiConfig) ensureAssetsDir() error {
@@ -10,3 +20,90 @@ func (cfg apiConfig) ensureAssetsDir() error {
 	}
 	return nil
 }
+
+// stagingPath is where an upload waits until it has been processed. Dot
+// directories under the assets root are neither served nor listed as
+// stored objects.
+func (cfg *apiConfig) stagingPath(id uuid.UUID) string {
+	return filepath.Join(cfg.assetsRoot, ".uploads", id.String())
+}
+
+func (cfg *apiConfig) createStagingFile(id uuid.UUID) (*os.File, error) {
+	p := cfg.stagingPath(id)
+	err := os.MkdirAll(filepath.Dir(p), 0755)
+	if err != nil {
+		return nil, err
+	}
+	return os.Create(p)
+}
+
+func getAssetPath(mediaType string) (string, error) {
+	base := make([]byte, 32)
+	_, err := rand.Read(base)
+	if err != nil {
+		return "", fmt.Errorf("couldn't generate asset name: %w", err)
+	}
+	id := base64.RawURLEncoding.EncodeToString(base)
+	return id + mediaTypeToExt(mediaType), nil
+}
+
+func mediaTypeToExt(mediaType string) string {
+	parts := strings.Split(mediaType, "/")
+	if len(parts) != 2 {
+		return ".bin"
+	}
+	return "." + parts[1]
+}
+
+// hideDotfiles keeps files under dot-directories of the assets root, such as
+// staged resumable uploads, from being served.
+func hideDotfiles(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, segment := range strings.Split(r.URL.Path, "/") {
+			if strings.HasPrefix(segment, ".") {
+				http.NotFound(w, r)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// protectPrivateAssets serves the files of private videos only to their
+// owner, so URLs handed out while a video was unlisted or public stop
+// working once it is private. Other viewers get signed
+// /api/videos/{videoID}/assets/ links instead.
+func (cfg *apiConfig) protectPrivateAssets(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Clean the path the way the file server will, so no spelling of
+		// a key slips past.
+		key := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		m := appObjectKey.FindStringSubmatch(key)
+		if m == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		videos, err := cfg.db.GetVideosByAssetName(m[1])
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+			return
+		}
+
+		private := false
+		for _, video := range videos {
+			if video.Visibility != database.VideoVisibilityPrivate || !cfg.referencedObjects([]database.Video{video}).contains(key) {
+				continue
+			}
+			userID, err := cfg.requestUserID(r)
+			if err != nil || !canViewVideo(video, userID) {
+				http.NotFound(w, r)
+				return
+			}
+			private = true
+		}
+		if private {
+			w.Header().Set("Cache-Control", "private, max-age=0, must-revalidate")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
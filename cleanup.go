@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const jobKindDeleteObjects = "delete_objects"
+
+// storedObjects names objects in the store: individual keys, and prefixes
+// everything under which belongs with them.
+type storedObjects struct {
+	Keys     []string `json:"keys"`
+	Prefixes []string `json:"prefixes"`
+}
+
+func (o storedObjects) empty() bool {
+	return len(o.Keys) == 0 && len(o.Prefixes) == 0
+}
+
+// add records the object at key along with its derived assets.
+func (o *storedObjects) add(key string) {
+	o.Keys = append(o.Keys, key)
+	o.Prefixes = append(o.Prefixes, assetPrefix(key))
+}
+
+// videoObjects returns everything stored for video: the video file and
+// thumbnail, and the HLS renditions, previews and thumbnail variants kept
+// under their asset prefixes. URLs that don't point into the store are
+// skipped.
+func (cfg *apiConfig) videoObjects(video database.Video) storedObjects {
+	var objects storedObjects
+	for _, u := range []*string{video.VideoURL, video.ThumbnailURL} {
+		if u == nil {
+			continue
+		}
+		if key, ok := cfg.objectKey(*u); ok {
+			objects.add(key)
+		}
+	}
+	return objects
+}
+
+// storedURLs points at every URL saved on video, so they can be checked or
+// rewritten in place.
+func storedURLs(video *database.Video) []*string {
+	urls := []*string{video.VideoURL, video.ThumbnailURL, video.HLSURL, video.PreviewsURL}
+	if video.Thumbnails != nil {
+		for _, variants := range [][]database.ThumbnailVariant{video.Thumbnails.JPEG, video.Thumbnails.WebP} {
+			for i := range variants {
+				urls = append(urls, &variants[i].URL)
+			}
+		}
+	}
+	return slices.DeleteFunc(urls, func(u *string) bool { return u == nil })
+}
+
+// enqueueObjectDeletion queues a job to remove objects from the store, so a
+// slow or failing store doesn't hold up the request and failures are
+// retried.
+func (cfg *apiConfig) enqueueObjectDeletion(objects storedObjects, userID uuid.UUID) error {
+	if objects.empty() {
+		return nil
+	}
+	payload, err := json.Marshal(objects)
+	if err != nil {
+		return err
+	}
+	_, err = cfg.db.EnqueueJob(database.EnqueueJobParams{
+		Kind:    jobKindDeleteObjects,
+		Payload: string(payload),
+		UserID:  &userID,
+	})
+	return err
+}
+
+func (cfg *apiConfig) runDeleteObjectsJob(ctx context.Context, job database.Job) error {
+	var objects storedObjects
+	err := json.Unmarshal([]byte(job.Payload), &objects)
+	if err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	return cfg.deleteObjects(ctx, objects)
+}
+
+func (cfg *apiConfig) giveUpDeleteObjectsJob(ctx context.Context, job database.Job) {
+	log.Printf("Gave up deleting objects for job %s; the gc command will report what's left", job.ID)
+}
+
+// deleteObjects removes objects from the store, carrying on past failures
+// so one bad key doesn't strand the rest. Deleting a missing key succeeds,
+// so it is safe to retry.
+func (cfg *apiConfig) deleteObjects(ctx context.Context, objects storedObjects) error {
+	var errs []error
+	keys := objects.Keys
+	for _, prefix := range objects.Prefixes {
+		listed, err := cfg.store.List(ctx, prefix)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("couldn't list %s: %w", prefix, err))
+			continue
+		}
+		for _, obj := range listed {
+			keys = append(keys, obj.Key)
+		}
+	}
+	for _, key := range keys {
+		err := cfg.store.Delete(ctx, key)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("couldn't delete %s: %w", key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// referencedObjects indexes every object some video refers to, for finding
+// the ones nothing does.
+type referencedObjects struct {
+	keys     map[string]bool
+	prefixes map[string]bool
+}
+
+func (cfg *apiConfig) referencedObjects(videos []database.Video) referencedObjects {
+	refs := referencedObjects{keys: map[string]bool{}, prefixes: map[string]bool{}}
+	for _, video := range videos {
+		objects := cfg.videoObjects(video)
+		for _, key := range objects.Keys {
+			refs.keys[key] = true
+		}
+		for _, prefix := range objects.Prefixes {
+			refs.prefixes[prefix] = true
+		}
+	}
+	return refs
+}
+
+func (r referencedObjects) contains(key string) bool {
+	if r.keys[key] {
+		return true
+	}
+	// Derived assets sit under a prefix ending at one of the key's slashes.
+	for i, c := range key {
+		if c == '/' && r.prefixes[key[:i+1]] {
+			return true
+		}
+	}
+	return false
+}
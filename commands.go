@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+)
+
+func (cfg *apiConfig) runCommand(args []string) error {
+	if args[0] == "migrate" {
+		return cfg.commandMigrate(args[1:])
+	}
+
+	err := cfg.migrate()
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "rewrite-cdn-urls":
+		return cfg.commandRewriteCDNURLs(args[1:])
+	case "gc":
+		return cfg.commandGC(args[1:])
+	default:
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// migrationFeatureHints says how to give the database the optional
+// features that some migrations need.
+var migrationFeatureHints = map[string]string{
+	"fts5": "build with -tags sqlite_fts5 (make build) for full-text search",
+}
+
+// migrate applies any pending schema migrations, logging each one. Outside
+// development it refuses to run without a migration's optional feature.
+func (cfg *apiConfig) migrate() error {
+	applied, err := cfg.db.Migrate()
+	for _, m := range applied {
+		log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't migrate database: %w", err)
+	}
+
+	statuses, err := cfg.db.MigrationStatuses()
+	if err != nil {
+		return fmt.Errorf("couldn't check migrations: %w", err)
+	}
+	for _, m := range statuses {
+		if m.AppliedAt != nil || m.Missing == "" {
+			continue
+		}
+		hint := migrationFeatureHints[m.Missing]
+		if cfg.platform != "dev" {
+			return fmt.Errorf("migration %04d_%s needs %s: %s", m.Version, m.Name, m.Missing, hint)
+		}
+		log.Printf("Skipping migration %04d_%s, which needs %s: %s", m.Version, m.Name, m.Missing, hint)
+	}
+	return nil
+}
+
+func (cfg *apiConfig) commandMigrate(args []string) error {
+	direction := "up"
+	if len(args) > 0 {
+		direction, args = args[0], args[1:]
+	}
+
+	switch direction {
+	case "up":
+		return cfg.migrate()
+	case "down":
+		flags := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+		steps := flags.Int("steps", 1, "number of migrations to roll back")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		if *steps < 1 {
+			return errors.New("steps must be at least 1")
+		}
+		reverted, err := cfg.db.Rollback(*steps)
+		for _, m := range reverted {
+			log.Printf("Rolled back migration %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			log.Print("No migrations to roll back")
+		}
+		return nil
+	case "status":
+		statuses, err := cfg.db.MigrationStatuses()
+		if err != nil {
+			return err
+		}
+		for _, m := range statuses {
+			applied := "pending"
+			if m.AppliedAt != nil {
+				applied = "applied " + m.AppliedAt.Format(time.RFC3339)
+			} else if m.Missing != "" {
+				applied = "pending, needs " + m.Missing
+			}
+			fmt.Printf("%04d_%s\t%s\n", m.Version, m.Name, applied)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate direction %q, expected up, down or status", direction)
+	}
+}
+
+func (cfg *apiConfig) commandRewriteCDNURLs(args []string) error {
+	flags := flag.NewFlagSet("rewrite-cdn-urls", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "print the changes without saving them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if cfg.s3CfDistribution == "" {
+		return errors.New("S3_CF_DISTRO must be set to rewrite URLs")
+	}
+
+	videos, err := cfg.db.GetAllVideos()
+	if err != nil {
+		return fmt.Errorf("couldn't get videos: %w", err)
+	}
+
+	updated := 0
+	for _, video := range videos {
+		changed := false
+		for _, u := range storedURLs(&video) {
+			if _, _, ok := parseBucketKey(*u); ok {
+				continue
+			}
+			key, ok := cfg.objectKey(*u)
+			if !ok {
+				log.Printf("video %s: skipping unrecognised URL %s", video.ID, *u)
+				continue
+			}
+			if cdnURL := cfg.objectURL(key); cdnURL != *u {
+				log.Printf("video %s: %s -> %s", video.ID, *u, cdnURL)
+				*u = cdnURL
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		updated++
+		if *dryRun {
+			continue
+		}
+		if err := cfg.db.UpdateVideo(video); err != nil {
+			return fmt.Errorf("couldn't update video %s: %w", video.ID, err)
+		}
+	}
+
+	log.Printf("Rewrote URLs of %d of %d videos", updated, len(videos))
+	return nil
+}
+
+// appObjectKey matches the keys the server stores objects under: a random
+// asset name, which is the submatch, under an orientation prefix for
+// videos, then its extension or, for derived assets, a slash and more. gc
+// leaves anything else in the store alone.
+var appObjectKey = regexp.MustCompile(`^(?:(?:` + strings.Join([]string{
+	media.OrientationPrefix(media.AspectRatioLandscape),
+	media.OrientationPrefix(media.AspectRatioPortrait),
+	media.OrientationPrefix(media.AspectRatioOther),
+}, "|") + `)/)?([A-Za-z0-9_-]{43})(?:\.[A-Za-z0-9.+-]+|/.+)$`)
+
+// commandGC reports objects in the store that no video refers to, such as
+// files replaced by a re-upload or left by a failed deletion, and removes
+// them with -delete. Objects newer than -min-age are left alone, since a
+// video being processed stores its files before the database knows of them.
+func (cfg *apiConfig) commandGC(args []string) error {
+	flags := flag.NewFlagSet("gc", flag.ContinueOnError)
+	deleteOrphans := flags.Bool("delete", false, "delete orphaned objects instead of only listing them")
+	minAge := flags.Duration("min-age", 24*time.Hour, "ignore objects modified more recently than this")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	videos, err := cfg.db.GetAllVideos()
+	if err != nil {
+		return fmt.Errorf("couldn't get videos: %w", err)
+	}
+	refs := cfg.referencedObjects(videos)
+
+	// A URL saved under another store or CDN configuration may still name
+	// an object here, which would then look orphaned.
+	unrecognised := 0
+	for i := range videos {
+		for _, u := range storedURLs(&videos[i]) {
+			if _, ok := cfg.objectKey(*u); !ok {
+				log.Printf("video %s: unrecognised URL %s", videos[i].ID, *u)
+				unrecognised++
+			}
+		}
+	}
+	if unrecognised > 0 && *deleteOrphans {
+		return fmt.Errorf("refusing to delete with %d unrecognised URLs, which may refer to objects that would look orphaned; fix or remove them first", unrecognised)
+	}
+
+	listed, err := cfg.store.List(ctx, "")
+	if err != nil {
+		return fmt.Errorf("couldn't list objects: %w", err)
+	}
+
+	var (
+		objects   int
+		foreign   int
+		orphans   int
+		size      int64
+		deleted   int
+		tooRecent int
+	)
+	cutoff := time.Now().Add(-*minAge)
+	for _, obj := range listed {
+		if !appObjectKey.MatchString(obj.Key) {
+			foreign++
+			continue
+		}
+		objects++
+		if refs.contains(obj.Key) {
+			continue
+		}
+		if obj.LastModified.After(cutoff) {
+			tooRecent++
+			continue
+		}
+		orphans++
+		size += obj.Size
+		log.Printf("orphan: %s (%s, modified %s)", obj.Key, formatByteSize(obj.Size), obj.LastModified.Format(time.RFC3339))
+		if !*deleteOrphans {
+			continue
+		}
+		if err := cfg.store.Delete(ctx, obj.Key); err != nil {
+			log.Printf("Couldn't delete %s: %v", obj.Key, err)
+			continue
+		}
+		deleted++
+	}
+
+	log.Printf("Found %d orphaned objects (%s) among %d; skipped %d newer than %s; ignored %d not named by the server", orphans, formatByteSize(size), objects, tooRecent, *minAge, foreign)
+	if unrecognised > 0 {
+		log.Printf("The %d unrecognised URLs may refer to some of the orphans", unrecognised)
+	}
+	if *deleteOrphans {
+		log.Printf("Deleted %d orphaned objects", deleted)
+	}
+	return nil
+}
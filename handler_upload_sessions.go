@@ -0,0 +1,437 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// Resumable uploads follow the shape of the tus protocol: a session is
+// created with the final size, chunks are appended with PATCH at the offset
+// reported by HEAD, and completing the session hands the staged file to the
+// same processing path as a single-shot upload.
+
+const uploadChunkContentType = "application/offset+octet-stream"
+
+func (cfg *apiConfig) lockUploadSession(sessionID uuid.UUID) (unlock func(), ok bool) {
+	v, _ := cfg.uploadLocks.LoadOrStore(sessionID, &sync.Mutex{})
+	mu := v.(*sync.Mutex)
+	if !mu.TryLock() {
+		return nil, false
+	}
+	return mu.Unlock, true
+}
+
+func (cfg *apiConfig) handlerUploadSessionCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Size      int64  `json:"size"`
+		MediaType string `json:"media_type"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't upload this video", nil)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Size <= 0 {
+		respondWithError(w, http.StatusBadRequest, "Size must be positive", nil)
+		return
+	}
+	if params.Size > cfg.maxVideoSize {
+		respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Video must be at most %s", formatByteSize(cfg.maxVideoSize)), nil)
+		return
+	}
+	mediaType, _, err := mime.ParseMediaType(params.MediaType)
+	if err != nil || !slices.Contains(allowedVideoTypes, mediaType) {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Video must be an MP4 file", err)
+		return
+	}
+
+	err = cfg.db.SetVideoStatus(videoID, database.VideoStatusUploading, "")
+	if errors.Is(err, database.ErrInvalidVideoStatusTransition) {
+		respondWithError(w, http.StatusConflict, "Video is already being processed", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video status", err)
+		return
+	}
+
+	session, err := cfg.db.CreateUploadSession(database.CreateUploadSessionParams{
+		VideoID:   videoID,
+		UserID:    userID,
+		MediaType: mediaType,
+		TotalSize: params.Size,
+		ExpiresAt: time.Now().Add(cfg.uploadSessionTTL),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create upload session", err)
+		return
+	}
+
+	f, err := cfg.createStagingFile(session.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create staging file", err)
+		return
+	}
+	f.Close()
+
+	w.Header().Set("Location", "/api/upload_sessions/"+session.ID.String())
+	respondWithJSON(w, http.StatusCreated, session)
+}
+
+// getUploadSession authenticates the request and loads the session in the
+// path, responding with an error and returning false if either fails.
+func (cfg *apiConfig) getUploadSession(w http.ResponseWriter, r *http.Request) (database.UploadSession, bool) {
+	sessionIDString := r.PathValue("sessionID")
+	sessionID, err := uuid.Parse(sessionIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return database.UploadSession{}, false
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.UploadSession{}, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return database.UploadSession{}, false
+	}
+
+	session, err := cfg.db.GetUploadSession(sessionID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get upload session", err)
+		return database.UploadSession{}, false
+	}
+	if session.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Upload session not found", nil)
+		return database.UploadSession{}, false
+	}
+	if session.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't access this upload session", nil)
+		return database.UploadSession{}, false
+	}
+	if session.Expired(time.Now()) {
+		respondWithError(w, http.StatusGone, "Upload session has expired", nil)
+		return database.UploadSession{}, false
+	}
+	return session, true
+}
+
+func (cfg *apiConfig) handlerUploadSessionStatus(w http.ResponseWriter, r *http.Request) {
+	session, ok := cfg.getUploadSession(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Upload-Offset", strconv.FormatInt(session.ReceivedSize, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(session.TotalSize, 10))
+	if session.CompletedAt == nil {
+		w.Header().Set("Upload-Expires", session.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (cfg *apiConfig) handlerUploadSessionPatch(w http.ResponseWriter, r *http.Request) {
+	session, ok := cfg.getUploadSession(w, r)
+	if !ok {
+		return
+	}
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if contentType != uploadChunkContentType {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Content-Type must be "+uploadChunkContentType, nil)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		respondWithError(w, http.StatusBadRequest, "Invalid Upload-Offset header", err)
+		return
+	}
+
+	unlock, ok := cfg.lockUploadSession(session.ID)
+	if !ok {
+		respondWithError(w, http.StatusConflict, "Another chunk is being written to this upload session", nil)
+		return
+	}
+	defer unlock()
+
+	// Re-read now that we hold the lock; the offset may have moved.
+	session, err = cfg.db.GetUploadSession(session.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get upload session", err)
+		return
+	}
+	if session.ID == uuid.Nil || session.Expired(time.Now()) {
+		respondWithError(w, http.StatusGone, "Upload session has expired", nil)
+		return
+	}
+	if session.CompletedAt != nil {
+		respondWithError(w, http.StatusConflict, "Upload session is already complete", nil)
+		return
+	}
+	if offset != session.ReceivedSize {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(session.ReceivedSize, 10))
+		respondWithError(w, http.StatusConflict, "Upload-Offset doesn't match the received size", nil)
+		return
+	}
+
+	f, err := os.OpenFile(cfg.stagingPath(session.ID), os.O_WRONLY, 0644)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open staging file", err)
+		return
+	}
+	defer f.Close()
+
+	// Drop anything a previously interrupted chunk wrote past the recorded offset.
+	err = f.Truncate(offset)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't prepare staging file", err)
+		return
+	}
+	_, err = f.Seek(offset, io.SeekStart)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't prepare staging file", err)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, session.TotalSize-offset)
+	written, copyErr := io.Copy(f, body)
+	if written > 0 {
+		err = f.Sync()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't write chunk", err)
+			return
+		}
+		err = cfg.db.AdvanceUploadSession(session.ID, offset, offset+written)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't record upload progress", err)
+			return
+		}
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset+written, 10))
+
+	if isUploadTooLarge(copyErr) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Chunk extends past the declared upload size", copyErr)
+		return
+	}
+	if copyErr != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't read chunk", copyErr)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerUploadSessionComplete(w http.ResponseWriter, r *http.Request) {
+	session, ok := cfg.getUploadSession(w, r)
+	if !ok {
+		return
+	}
+
+	unlock, ok := cfg.lockUploadSession(session.ID)
+	if !ok {
+		respondWithError(w, http.StatusConflict, "Upload session is busy", nil)
+		return
+	}
+	defer unlock()
+
+	session, err := cfg.db.GetUploadSession(session.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get upload session", err)
+		return
+	}
+	if session.ID == uuid.Nil || session.Expired(time.Now()) {
+		respondWithError(w, http.StatusGone, "Upload session has expired", nil)
+		return
+	}
+	if session.CompletedAt != nil {
+		respondWithError(w, http.StatusConflict, "Upload session is already complete", nil)
+		return
+	}
+	if session.ReceivedSize != session.TotalSize {
+		respondWithError(w, http.StatusConflict, fmt.Sprintf("Upload is incomplete: received %d of %d bytes", session.ReceivedSize, session.TotalSize), nil)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(session.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != session.UserID {
+		respondWithError(w, http.StatusForbidden, "You can't upload this video", nil)
+		return
+	}
+
+	stagingPath := cfg.stagingPath(session.ID)
+	f, err := os.Open(stagingPath)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open staging file", err)
+		return
+	}
+	defer f.Close()
+
+	mediaType, err := detectUploadMediaType(f, session.MediaType, allowedVideoTypes)
+	if errors.Is(err, errUnsupportedMediaType) {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Video must be an MP4 file", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't read uploaded file", err)
+		return
+	}
+
+	// Complete the session before queueing the job, so the expiry sweep
+	// never removes a staging file a queued job still needs.
+	err = cfg.db.CompleteUploadSession(session.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't complete upload session", err)
+		return
+	}
+
+	job, err := cfg.enqueueVideoProcessing(video, stagingPath, mediaType)
+	if err != nil {
+		// Nothing will process the upload, so let the client try again.
+		if reopenErr := cfg.db.ReopenUploadSession(session.ID); reopenErr != nil {
+			log.Printf("Couldn't reopen upload session %s: %v", session.ID, reopenErr)
+		}
+	}
+	if errors.Is(err, database.ErrInvalidVideoStatusTransition) {
+		respondWithError(w, http.StatusConflict, "Video is already being processed", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't queue video for processing", err)
+		return
+	}
+	cfg.uploadLocks.Delete(session.ID)
+
+	w.Header().Set("Location", "/api/jobs/"+job.ID.String())
+	respondWithJSON(w, http.StatusAccepted, job)
+}
+
+const uploadSessionSweepInterval = 10 * time.Minute
+
+// runUploadSessionSweeper periodically removes expired upload sessions until
+// ctx is cancelled.
+func (cfg *apiConfig) runUploadSessionSweeper(ctx context.Context) {
+	ticker := time.NewTicker(uploadSessionSweepInterval)
+	defer ticker.Stop()
+	for {
+		err := cfg.sweepUploadSessions()
+		if err != nil {
+			log.Printf("Couldn't sweep upload sessions: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweepUploadSessions deletes expired sessions. Unfinished ones take their
+// staging files with them, and their video goes from uploading to failed
+// unless another session is still under way. The staging files of completed
+// sessions belong to their processing job, so are left alone.
+func (cfg *apiConfig) sweepUploadSessions() error {
+	now := time.Now()
+	sessions, err := cfg.db.GetExpiredUploadSessions(now)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, session := range sessions {
+		unlock, ok := cfg.lockUploadSession(session.ID)
+		if !ok {
+			// A chunk is still being written; try again next time.
+			continue
+		}
+		err := cfg.expireUploadSession(session, now)
+		unlock()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("session %s: %w", session.ID, err))
+			continue
+		}
+		cfg.uploadLocks.Delete(session.ID)
+	}
+	return errors.Join(errs...)
+}
+
+func (cfg *apiConfig) expireUploadSession(session database.UploadSession, now time.Time) error {
+	if session.CompletedAt == nil {
+		err := os.Remove(cfg.stagingPath(session.ID))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	err := cfg.db.DeleteUploadSession(session.ID)
+	if err != nil || session.CompletedAt != nil {
+		return err
+	}
+
+	open, err := cfg.db.GetOpenUploadSessions(session.VideoID)
+	if err != nil {
+		return err
+	}
+	for _, other := range open {
+		if !other.Expired(now) {
+			return nil
+		}
+	}
+	video, err := cfg.db.GetVideo(session.VideoID)
+	if err != nil || video.Status != database.VideoStatusUploading {
+		return err
+	}
+	return cfg.db.SetVideoStatus(video.ID, database.VideoStatusFailed, "Upload session expired")
+}
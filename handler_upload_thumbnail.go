@@ -1,10 +1,13 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/imaging"
 	"github.com/google/uuid"
 )
 
@@ -28,10 +31,83 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't upload a thumbnail for this video", nil)
+		return
+	}
+
+	err = parseUploadForm(w, r, cfg.maxThumbnailSize)
+	if isUploadTooLarge(err) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Thumbnail must be at most %s", formatByteSize(cfg.maxThumbnailSize)), err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse multipart form", err)
+		return
+	}
+
+	file, header, err := r.FormFile("thumbnail")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Unable to parse form file", err)
+		return
+	}
+	defer file.Close()
+
+	if header.Size > cfg.maxThumbnailSize {
+		respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Thumbnail must be at most %s", formatByteSize(cfg.maxThumbnailSize)), nil)
+		return
+	}
+
+	mediaType, err := detectUploadMediaType(file, header.Header.Get("Content-Type"), allowedThumbnailTypes)
+	if errors.Is(err, errUnsupportedMediaType) {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Thumbnail must be a JPEG, PNG or WebP image", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't read uploaded file", err)
+		return
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't read uploaded file", err)
+		return
+	}
+
+	thumbnailURL, thumbnails, err := cfg.saveThumbnail(r.Context(), data, mediaType)
+	if errors.Is(err, imaging.ErrInvalidImage) {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode thumbnail image", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't store thumbnail", err)
+		return
+	}
 
-	fmt.Println("uploading thumbnail for video", videoID, "by user", userID)
+	// Only touch the thumbnail columns: the upload may have raced a
+	// processing job updating the rest of the video.
+	err = cfg.db.SetVideoThumbnail(video.ID, thumbnailURL, thumbnails)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
 
-	// TODO: implement the upload here
+	video, err = cfg.db.GetVideo(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+
+	video, err = cfg.dbVideoToSignedVideo(r.Context(), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate presigned URL", err)
+		return
+	}
 
-	respondWithJSON(w, http.StatusOK, struct{}{})
+	respondWithJSON(w, http.StatusOK, video)
 }
@@ -1,7 +1,108 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"os"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
 )
 
-func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request) {}
+func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't upload this video", nil)
+		return
+	}
+	if !video.Status.CanTransitionTo(database.VideoStatusProcessing) {
+		respondWithError(w, http.StatusConflict, "Video is already being processed", nil)
+		return
+	}
+
+	err = parseUploadForm(w, r, cfg.maxVideoSize)
+	if isUploadTooLarge(err) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Video must be at most %s", formatByteSize(cfg.maxVideoSize)), err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse multipart form", err)
+		return
+	}
+
+	file, header, err := r.FormFile("video")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Unable to parse form file", err)
+		return
+	}
+	defer file.Close()
+
+	if header.Size > cfg.maxVideoSize {
+		respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Video must be at most %s", formatByteSize(cfg.maxVideoSize)), nil)
+		return
+	}
+
+	mediaType, err := detectUploadMediaType(file, header.Header.Get("Content-Type"), allowedVideoTypes)
+	if errors.Is(err, errUnsupportedMediaType) {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Video must be an MP4 file", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't read uploaded file", err)
+		return
+	}
+
+	stagingFile, err := cfg.createStagingFile(uuid.New())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create staging file", err)
+		return
+	}
+	defer stagingFile.Close()
+
+	_, err = io.Copy(stagingFile, file)
+	if err != nil {
+		os.Remove(stagingFile.Name())
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save uploaded file", err)
+		return
+	}
+
+	job, err := cfg.enqueueVideoProcessing(video, stagingFile.Name(), mediaType)
+	if errors.Is(err, database.ErrInvalidVideoStatusTransition) {
+		os.Remove(stagingFile.Name())
+		respondWithError(w, http.StatusConflict, "Video is already being processed", err)
+		return
+	}
+	if err != nil {
+		os.Remove(stagingFile.Name())
+		respondWithError(w, http.StatusInternalServerError, "Couldn't queue video for processing", err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/jobs/"+job.ID.String())
+	respondWithJSON(w, http.StatusAccepted, job)
+}
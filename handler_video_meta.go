@@ -2,7 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
@@ -33,6 +38,18 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 		return
 	}
 	params.UserID = userID
+	if msg := validateVideoTitle(params.Title); msg != "" {
+		respondWithError(w, http.StatusBadRequest, msg, nil)
+		return
+	}
+	if msg := validateVideoDescription(params.Description); msg != "" {
+		respondWithError(w, http.StatusBadRequest, msg, nil)
+		return
+	}
+	if params.Visibility != "" && !params.Visibility.Valid() {
+		respondWithError(w, http.StatusBadRequest, "Visibility must be private, unlisted or public", nil)
+		return
+	}
 
 	video, err := cfg.db.CreateVideo(params.CreateVideoParams)
 	if err != nil {
@@ -43,6 +60,110 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 	respondWithJSON(w, http.StatusCreated, video)
 }
 
+// handlerVideoMetaUpdate applies a partial update: only the fields present
+// in the body change. Clients can send the ETag from a previous read in
+// If-Match to avoid overwriting someone else's edit.
+func (cfg *apiConfig) handlerVideoMetaUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Title       *string                   `json:"title"`
+		Description *string                   `json:"description"`
+		Visibility  *database.VideoVisibility `json:"visibility"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't update this video", nil)
+		return
+	}
+	if !ifMatch(r, videoETag(video)) {
+		w.Header().Set("ETag", videoETag(video))
+		respondWithError(w, http.StatusPreconditionFailed, "Video has changed since it was read", nil)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	if params.Title != nil {
+		if msg := validateVideoTitle(*params.Title); msg != "" {
+			respondWithError(w, http.StatusBadRequest, msg, nil)
+			return
+		}
+		video.Title = *params.Title
+	}
+	if params.Description != nil {
+		if msg := validateVideoDescription(*params.Description); msg != "" {
+			respondWithError(w, http.StatusBadRequest, msg, nil)
+			return
+		}
+		video.Description = *params.Description
+	}
+	if params.Visibility != nil {
+		if !params.Visibility.Valid() {
+			respondWithError(w, http.StatusBadRequest, "Visibility must be private, unlisted or public", nil)
+			return
+		}
+		video.Visibility = *params.Visibility
+	}
+
+	err = cfg.db.UpdateVideoIfUnmodified(video, video.UpdatedAt)
+	if errors.Is(err, database.ErrVideoModified) {
+		respondWithError(w, http.StatusPreconditionFailed, "Video has changed since it was read", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+
+	video, err = cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+
+	w.Header().Set("ETag", videoETag(video))
+	video, err = cfg.dbVideoToSignedVideo(r.Context(), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate presigned URL", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, video)
+}
+
 func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Request) {
 	videoIDString := r.PathValue("videoID")
 	videoID, err := uuid.Parse(videoIDString)
@@ -72,26 +193,47 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// Deleting the video deletes its upload sessions, so find their staging
+	// files first.
+	sessions, err := cfg.db.GetOpenUploadSessions(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get upload sessions", err)
+		return
+	}
+
 	err = cfg.db.DeleteVideo(videoID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
 		return
 	}
 
+	for _, session := range sessions {
+		err := os.Remove(cfg.stagingPath(session.ID))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Couldn't remove staging file of upload session %s: %v", session.ID, err)
+		}
+	}
+
+	// The video is gone either way; anything left behind is reported by
+	// the gc command.
+	err = cfg.enqueueObjectDeletion(cfg.videoObjects(video), video.UserID)
+	if err != nil {
+		log.Printf("Couldn't queue deletion of video %s's objects: %v", video.ID, err)
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
-	videoIDString := r.PathValue("videoID")
-	videoID, err := uuid.Parse(videoIDString)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+	video, ok := cfg.authorizeVideoView(w, r)
+	if !ok {
 		return
 	}
 
-	video, err := cfg.db.GetVideo(videoID)
+	w.Header().Set("ETag", videoETag(video))
+	video, err := cfg.dbVideoToSignedVideo(r.Context(), video)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate presigned URL", err)
 		return
 	}
 
@@ -110,11 +252,112 @@ func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	videos, err := cfg.db.GetVideos(userID)
+	params, msg := parseListVideosParams(r.URL.Query())
+	if msg != "" {
+		respondWithError(w, http.StatusBadRequest, msg, nil)
+		return
+	}
+	params.UserID = userID
+
+	videos, more, err := cfg.db.ListVideos(params)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
+		return
+	}
+
+	var nextCursor *string
+	if more {
+		cursor := encodeVideoCursor(params.Sort, params.Descending, videos[len(videos)-1])
+		nextCursor = &cursor
+	}
+
+	for i, video := range videos {
+		videos[i], err = cfg.dbVideoToSignedVideo(r.Context(), video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't generate presigned URL", err)
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, struct {
+		Videos     []database.Video `json:"videos"`
+		NextCursor *string          `json:"next_cursor"`
+	}{
+		Videos:     videos,
+		NextCursor: nextCursor,
+	})
+}
+
+func (cfg *apiConfig) handlerVideosPublic(w http.ResponseWriter, r *http.Request) {
+	videos, err := cfg.db.GetPublicVideos()
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
 		return
 	}
 
+	for i, video := range videos {
+		videos[i], err = cfg.dbVideoToSignedVideo(r.Context(), video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't generate presigned URL", err)
+			return
+		}
+	}
+
 	respondWithJSON(w, http.StatusOK, videos)
 }
+
+func (cfg *apiConfig) handlerVideosSearch(w http.ResponseWriter, r *http.Request) {
+	type searchResult struct {
+		database.Video
+		Rank               float64 `json:"rank"`
+		TitleSnippet       string  `json:"title_snippet"`
+		DescriptionSnippet string  `json:"description_snippet"`
+	}
+
+	userID, err := cfg.requestUserID(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+	if strings.TrimSpace(query) == "" {
+		respondWithError(w, http.StatusBadRequest, "q is required", nil)
+		return
+	}
+	limit := defaultVideoPageSize
+	if l := r.URL.Query().Get("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > maxVideoPageSize {
+			respondWithError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxVideoPageSize), nil)
+			return
+		}
+	}
+
+	matches, err := cfg.db.SearchVideos(database.SearchVideosParams{
+		Query:    query,
+		ViewerID: userID,
+		Limit:    limit,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't search videos", err)
+		return
+	}
+
+	results := make([]searchResult, len(matches))
+	for i, match := range matches {
+		video, err := cfg.dbVideoToSignedVideo(r.Context(), match.Video)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't generate presigned URL", err)
+			return
+		}
+		results[i] = searchResult{
+			Video:              video,
+			Rank:               match.Rank,
+			TitleSnippet:       highlightSnippet(match.TitleSnippet),
+			DescriptionSnippet: highlightSnippet(match.DescriptionSnippet),
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, results)
+}
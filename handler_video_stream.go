@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"path"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+// handlerVideoStream serves a video's processed file to viewers the usual
+// visibility rules let in, or to holders of a URL from signedStreamURL,
+// after finding its key in the store.
+func (cfg *apiConfig) handlerVideoStream(w http.ResponseWriter, r *http.Request) {
+	var video database.Video
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err == nil && cfg.hasValidStreamSignature(r, videoID) {
+		video, err = cfg.db.GetVideo(videoID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+			return
+		}
+		if video.ID == uuid.Nil {
+			respondWithError(w, http.StatusNotFound, "Video not found", nil)
+			return
+		}
+	} else {
+		var ok bool
+		video, ok = cfg.authorizeVideoView(w, r)
+		if !ok {
+			return
+		}
+	}
+	if video.VideoURL == nil {
+		respondWithError(w, http.StatusNotFound, "Video has no file yet", nil)
+		return
+	}
+
+	key, ok := cfg.objectKey(*video.VideoURL)
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Video file not found", nil)
+		return
+	}
+	cfg.serveObject(w, r, key, video.Visibility == database.VideoVisibilityPrivate)
+}
+
+// handlerVideoAsset serves one of a video's stored files, such as an HLS
+// segment or preview sprite, to holders of a URL from signedAssetURL.
+func (cfg *apiConfig) handlerVideoAsset(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil || !cfg.validVideoSignature("assets", videoID, r.PathValue("expires"), r.PathValue("signature")) {
+		respondWithError(w, http.StatusForbidden, "Invalid or expired signature", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	key := r.PathValue("key")
+	if video.ID == uuid.Nil || path.Clean(key) != key || !cfg.referencedObjects([]database.Video{video}).contains(key) {
+		respondWithError(w, http.StatusNotFound, "Asset not found", nil)
+		return
+	}
+	// Signed URLs are as good as a bearer token, so keep shared caches out
+	// of it whatever the video's visibility.
+	cfg.serveObject(w, r, key, true)
+}
+
+// serveObject streams the object at key from the store, with
+// http.ServeContent taking care of Range, If-Range and conditional requests.
+func (cfg *apiConfig) serveObject(w http.ResponseWriter, r *http.Request, key string, private bool) {
+	info, err := cfg.store.Stat(r.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "File not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't read file", err)
+		return
+	}
+
+	body := storage.NewRangeReader(r.Context(), cfg.store, info)
+	defer body.Close()
+
+	if info.ContentType != "" {
+		w.Header().Set("Content-Type", info.ContentType)
+	}
+	if info.ETag != "" {
+		w.Header().Set("ETag", info.ETag)
+	}
+	if private {
+		w.Header().Set("Cache-Control", "private, max-age=0, must-revalidate")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=0, must-revalidate")
+	}
+	http.ServeContent(w, r, path.Base(key), info.LastModified, body)
+}
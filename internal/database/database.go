@@ -4,86 +4,99 @@ import (
 	"database/sql"
 	"fmt"
 
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 type Client struct {
-	db *sql.DB
+	db conn
 }
 
-func NewClient(pathToDB string) (Client, error) {
-	db, err := sql.Open("sqlite3", pathToDB)
+// NewClient opens the database at dbURL: a postgres:// or postgresql:// URL
+// for PostgreSQL, or a path to a SQLite file.
+func NewClient(dbURL string) (Client, error) {
+	d, dsn := parseDBURL(dbURL)
+	db, err := sql.Open(string(d), dsn)
 	if err != nil {
 		return Client{}, err
 	}
-	c := Client{db}
-	err = c.autoMigrate()
-	if err != nil {
-		return Client{}, err
-	}
-	return c, nil
+	return Client{conn{db, d}}, nil
+}
 
+// upgradeLegacySchema adds the columns that the start-up migration used to
+// bolt onto videos, so databases created before versioned migrations match
+// the initial migration and can adopt it.
+func (c *Client) upgradeLegacySchema() error {
+	for _, column := range []struct{ name, definition string }{
+		{"aspect_ratio", "TEXT"},
+		{"hls_url", "TEXT"},
+		{"status", "TEXT NOT NULL DEFAULT 'draft'"},
+		{"status_message", "TEXT"},
+		{"thumbnails", "TEXT"},
+		{"previews_url", "TEXT"},
+		// Before visibility existed every video was reachable by anyone
+		// with its ID, so existing rows become unlisted.
+		{"visibility", "TEXT NOT NULL DEFAULT 'unlisted'"},
+		{"duration_seconds", "REAL"},
+		{"width", "INTEGER"},
+		{"height", "INTEGER"},
+		{"video_codec", "TEXT"},
+		{"audio_codec", "TEXT"},
+		{"bitrate", "INTEGER"},
+		{"frame_rate", "REAL"},
+		{"audio_channels", "INTEGER"},
+		{"container_format", "TEXT"},
+	} {
+		err := c.addColumnIfNotExists("videos", column.name, column.definition)
+		if err != nil {
+			return err
+		}
+	}
+	// Videos uploaded before statuses existed are playable already.
+	_, err := c.db.Exec("UPDATE videos SET status = 'ready' WHERE status = 'draft' AND video_url IS NOT NULL")
+	return err
 }
 
-func (c *Client) autoMigrate() error {
-	userTable := `
-	CREATE TABLE IF NOT EXISTS users (
-		id TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		password TEXT NOT NULL,
-		email TEXT UNIQUE NOT NULL
-	);
-	`
-	_, err := c.db.Exec(userTable)
+func (c *Client) addColumnIfNotExists(table, column, definition string) error {
+	rows, err := c.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
 	if err != nil {
 		return err
 	}
-	refreshTokenTable := `
-	CREATE TABLE IF NOT EXISTS refresh_tokens (
-		token TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		revoked_at TIMESTAMP,
-		user_id TEXT NOT NULL,
-		expires_at TIMESTAMP NOT NULL,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);
-	`
-	_, err = c.db.Exec(refreshTokenTable)
-	if err != nil {
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    bool
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
 		return err
 	}
 
-	videoTable := `
-	CREATE TABLE IF NOT EXISTS videos (
-		id TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		title TEXT NOT NULL,
-		description TEXT,
-		thumbnail_url TEXT,
-		video_url TEXT TEXT,
-		user_id INTEGER,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);
-	`
-	_, err = c.db.Exec(videoTable)
+	_, err = c.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
 	}
 	return nil
 }
 
+// Reset deletes every row, children before the tables they refer to.
 func (c Client) Reset() error {
-	if _, err := c.db.Exec("DELETE FROM refresh_tokens"); err != nil {
-		return fmt.Errorf("failed to reset table refresh_tokens: %w", err)
-	}
-	if _, err := c.db.Exec("DELETE FROM users"); err != nil {
-		return fmt.Errorf("failed to reset table users: %w", err)
-	}
-	if _, err := c.db.Exec("DELETE FROM videos"); err != nil {
-		return fmt.Errorf("failed to reset table videos: %w", err)
+	for _, table := range []string{"jobs", "upload_sessions", "videos", "refresh_tokens", "users"} {
+		if _, err := c.db.Exec("DELETE FROM " + table); err != nil {
+			return fmt.Errorf("failed to reset table %s: %w", table, err)
+		}
 	}
 	return nil
 }
@@ -0,0 +1,131 @@
+package database
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// forEachDialect runs test against a fresh SQLite database and, if
+// TEST_POSTGRES_URL is set, a fresh schema in that PostgreSQL database.
+func forEachDialect(t *testing.T, test func(t *testing.T, c Client)) {
+	t.Run("sqlite", func(t *testing.T) {
+		// Enforce foreign keys, which go-sqlite3 leaves off, as PostgreSQL does.
+		c, err := NewClient(filepath.Join(t.TempDir(), "tubely.db") + "?_foreign_keys=on")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.db.Close() })
+		test(t, c)
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		dbURL := os.Getenv("TEST_POSTGRES_URL")
+		if dbURL == "" {
+			t.Skip("TEST_POSTGRES_URL not set")
+		}
+		test(t, newPostgresTestClient(t, dbURL))
+	})
+}
+
+// newPostgresTestClient connects to dbURL with a schema of its own, which
+// is dropped when the test ends.
+func newPostgresTestClient(t *testing.T, dbURL string) Client {
+	t.Helper()
+	admin, err := NewClient(dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.db.Close() })
+
+	suffix := make([]byte, 8)
+	rand.Read(suffix)
+	schema := "tubely_test_" + hex.EncodeToString(suffix)
+	_, err = admin.db.Exec("CREATE SCHEMA " + schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.db.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("couldn't drop schema %s: %v", schema, err)
+		}
+	})
+
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+	c, err := NewClient(u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.db.Close() })
+	return c
+}
+
+// forEachMigratedDialect is forEachDialect with the schema migrated.
+func forEachMigratedDialect(t *testing.T, test func(t *testing.T, c Client)) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		if _, err := c.Migrate(); err != nil {
+			t.Fatal(err)
+		}
+		test(t, c)
+	})
+}
+
+func createTestUser(t *testing.T, c Client, email string) *User {
+	t.Helper()
+	user, err := c.CreateUser(CreateUserParams{Email: email, Password: "hash"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestReset(t *testing.T) {
+	forEachMigratedDialect(t, func(t *testing.T, c Client) {
+		user := createTestUser(t, c, "owner@example.com")
+		video, err := c.CreateVideo(CreateVideoParams{Title: "Reset me", UserID: user.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = c.CreateUploadSession(CreateUploadSessionParams{
+			VideoID:   video.ID,
+			UserID:    user.ID,
+			MediaType: "video/mp4",
+			TotalSize: 1024,
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = c.CreateRefreshToken(CreateRefreshTokenParams{Token: "token", UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = c.EnqueueJob(EnqueueJobParams{Kind: "test", Payload: "{}", UserID: &user.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := c.Reset(); err != nil {
+			t.Fatal(err)
+		}
+		for _, table := range []string{"jobs", "upload_sessions", "videos", "refresh_tokens", "users"} {
+			var n int
+			if err := c.db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&n); err != nil {
+				t.Fatal(err)
+			}
+			if n != 0 {
+				t.Errorf("%s has %d rows after Reset, want 0", table, n)
+			}
+		}
+	})
+}
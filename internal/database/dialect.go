@@ -0,0 +1,132 @@
+package database
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+)
+
+// dialect is the SQL flavour of the database a Client talks to. Queries in
+// this package are written with ? placeholders and rebound as needed.
+type dialect string
+
+const (
+	dialectSQLite   dialect = "sqlite3"
+	dialectPostgres dialect = "postgres"
+)
+
+// parseDBURL picks the driver for dbURL. postgres:// and postgresql:// URLs
+// go to PostgreSQL; anything else is a SQLite path, optionally prefixed with
+// sqlite://.
+func parseDBURL(dbURL string) (dialect, string) {
+	if strings.HasPrefix(dbURL, "postgres://") || strings.HasPrefix(dbURL, "postgresql://") {
+		return dialectPostgres, dbURL
+	}
+	if path, ok := strings.CutPrefix(dbURL, "sqlite://"); ok {
+		return dialectSQLite, path
+	}
+	return dialectSQLite, dbURL
+}
+
+// rebind rewrites ? placeholders into the dialect's own form. Question marks
+// inside quoted literals are left alone.
+func (d dialect) rebind(query string) string {
+	if d != dialectPostgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	inQuote := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inQuote = !inQuote
+		case r == '?' && !inQuote:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// skipLocked is appended to a SELECT that picks rows to claim, so concurrent
+// claimers on PostgreSQL pass over each other's rows instead of queueing.
+// SQLite serialises writers, so it needs nothing.
+func (d dialect) skipLocked() string {
+	if d == dialectPostgres {
+		return "FOR UPDATE SKIP LOCKED"
+	}
+	return ""
+}
+
+// collateBytewise makes comparisons and ordering on a text expression go
+// byte by byte, as SQLite's do by default, rather than by PostgreSQL's
+// locale-aware collation.
+func (d dialect) collateBytewise(expr string) string {
+	if d == dialectPostgres {
+		return expr + ` COLLATE "C"`
+	}
+	return expr
+}
+
+func (d dialect) tableExistsQuery() string {
+	if d == dialectPostgres {
+		return "SELECT table_name FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?"
+	}
+	return "SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?"
+}
+
+func (d dialect) timestampType() string {
+	if d == dialectPostgres {
+		return "TIMESTAMPTZ"
+	}
+	return "TIMESTAMP"
+}
+
+// conn is a *sql.DB that rebinds placeholders for its dialect.
+type conn struct {
+	*sql.DB
+	dialect dialect
+}
+
+func (c conn) Exec(query string, args ...any) (sql.Result, error) {
+	return c.DB.Exec(c.dialect.rebind(query), args...)
+}
+
+func (c conn) Query(query string, args ...any) (*sql.Rows, error) {
+	return c.DB.Query(c.dialect.rebind(query), args...)
+}
+
+func (c conn) QueryRow(query string, args ...any) *sql.Row {
+	return c.DB.QueryRow(c.dialect.rebind(query), args...)
+}
+
+func (c conn) Begin() (tx, error) {
+	t, err := c.DB.Begin()
+	if err != nil {
+		return tx{}, err
+	}
+	return tx{t, c.dialect}, nil
+}
+
+// tx is a *sql.Tx that rebinds placeholders for its dialect.
+type tx struct {
+	*sql.Tx
+	dialect dialect
+}
+
+func (t tx) Exec(query string, args ...any) (sql.Result, error) {
+	return t.Tx.Exec(t.dialect.rebind(query), args...)
+}
+
+func (t tx) Query(query string, args ...any) (*sql.Rows, error) {
+	return t.Tx.Query(t.dialect.rebind(query), args...)
+}
+
+func (t tx) QueryRow(query string, args ...any) *sql.Row {
+	return t.Tx.QueryRow(t.dialect.rebind(query), args...)
+}
@@ -0,0 +1,292 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type JobStatus string
+
+const (
+	JobStatusQueued    JobStatus = "queued"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusSucceeded JobStatus = "succeeded"
+	JobStatusFailed    JobStatus = "failed"
+)
+
+var ErrJobLeaseLost = errors.New("job lease lost")
+
+type Job struct {
+	ID             uuid.UUID  `json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	Status         JobStatus  `json:"status"`
+	Attempts       int        `json:"attempts"`
+	RunAt          time.Time  `json:"run_at"`
+	LeasedBy       *string    `json:"-"`
+	LeaseExpiresAt *time.Time `json:"-"`
+	LastError      *string    `json:"last_error"`
+	CompletedAt    *time.Time `json:"completed_at"`
+	EnqueueJobParams
+}
+
+type EnqueueJobParams struct {
+	Kind        string     `json:"kind"`
+	Payload     string     `json:"-"`
+	UserID      *uuid.UUID `json:"user_id"`
+	MaxAttempts int        `json:"max_attempts"`
+}
+
+const defaultJobMaxAttempts = 5
+
+const jobColumns = `
+		id,
+		created_at,
+		updated_at,
+		kind,
+		payload,
+		user_id,
+		status,
+		attempts,
+		max_attempts,
+		run_at,
+		leased_by,
+		lease_expires_at,
+		last_error,
+		completed_at`
+
+func scanJob(row rowScanner) (Job, error) {
+	var job Job
+	err := row.Scan(
+		&job.ID,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&job.Kind,
+		&job.Payload,
+		&job.UserID,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.RunAt,
+		&job.LeasedBy,
+		&job.LeaseExpiresAt,
+		&job.LastError,
+		&job.CompletedAt,
+	)
+	return job, err
+}
+
+func (c Client) EnqueueJob(params EnqueueJobParams) (Job, error) {
+	id := uuid.New()
+	if params.MaxAttempts <= 0 {
+		params.MaxAttempts = defaultJobMaxAttempts
+	}
+	now := time.Now().UTC()
+	query := `
+	INSERT INTO jobs (
+		id,
+		created_at,
+		updated_at,
+		kind,
+		payload,
+		user_id,
+		status,
+		attempts,
+		max_attempts,
+		run_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, 0, ?, ?)
+	`
+	_, err := c.db.Exec(query, id, now, now, params.Kind, params.Payload, params.UserID, JobStatusQueued, params.MaxAttempts, now)
+	if err != nil {
+		return Job{}, err
+	}
+
+	return c.GetJob(id)
+}
+
+func (c Client) GetJob(id uuid.UUID) (Job, error) {
+	query := `
+	SELECT ` + jobColumns + `
+	FROM jobs
+	WHERE id = ?
+	`
+	job, err := scanJob(c.db.QueryRow(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Job{}, nil
+		}
+		return Job{}, err
+	}
+	return job, nil
+}
+
+// LeaseJob claims the oldest runnable job for workerID until the lease
+// expires. It returns nil when there is nothing to do.
+func (c Client) LeaseJob(workerID string, lease time.Duration) (*Job, error) {
+	now := time.Now().UTC()
+	query := `
+	UPDATE jobs
+	SET
+		status = ?,
+		attempts = attempts + 1,
+		leased_by = ?,
+		lease_expires_at = ?,
+		updated_at = ?
+	WHERE id = (
+		SELECT id
+		FROM jobs
+		WHERE status = ? AND run_at <= ?
+		ORDER BY run_at
+		LIMIT 1
+		` + c.db.dialect.skipLocked() + `
+	)
+	RETURNING ` + jobColumns
+
+	job, err := scanJob(c.db.QueryRow(
+		query,
+		JobStatusRunning,
+		workerID,
+		now.Add(lease),
+		now,
+		JobStatusQueued,
+		now,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// HeartbeatJob extends the lease workerID holds on a job. It returns
+// ErrJobLeaseLost if the lease expired and the job was handed to someone else.
+func (c Client) HeartbeatJob(id uuid.UUID, workerID string, lease time.Duration) error {
+	now := time.Now().UTC()
+	query := `
+	UPDATE jobs
+	SET
+		lease_expires_at = ?,
+		updated_at = ?
+	WHERE id = ? AND status = ? AND leased_by = ?
+	`
+	return c.execLeased(query, now.Add(lease), now, id, JobStatusRunning, workerID)
+}
+
+func (c Client) CompleteJob(id uuid.UUID, workerID string) error {
+	now := time.Now().UTC()
+	query := `
+	UPDATE jobs
+	SET
+		status = ?,
+		leased_by = NULL,
+		lease_expires_at = NULL,
+		last_error = NULL,
+		completed_at = ?,
+		updated_at = ?
+	WHERE id = ? AND status = ? AND leased_by = ?
+	`
+	return c.execLeased(query, JobStatusSucceeded, now, now, id, JobStatusRunning, workerID)
+}
+
+// FailJob records a failed attempt. The job is queued again after retryAfter
+// unless it has used up its attempts, in which case it is marked failed for
+// good. The updated job is returned.
+func (c Client) FailJob(id uuid.UUID, workerID string, jobErr error, retryAfter time.Duration) (Job, error) {
+	job, err := c.GetJob(id)
+	if err != nil {
+		return Job{}, err
+	}
+	return c.failAttempt(job, jobErr.Error(), retryAfter, "leased_by = ?", workerID)
+}
+
+// GetExpiredJobLeases returns the running jobs whose lease has run out,
+// because their worker died or stopped sending heartbeats.
+func (c Client) GetExpiredJobLeases() ([]Job, error) {
+	query := `
+	SELECT ` + jobColumns + `
+	FROM jobs
+	WHERE status = ? AND lease_expires_at <= ?
+	ORDER BY run_at
+	`
+	rows, err := c.db.Query(query, JobStatusRunning, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// ExpireJobLease counts an attempt whose lease ran out as failed, with the
+// same retries as FailJob. It returns ErrJobLeaseLost if the lease has been
+// extended or the attempt recorded since job was read.
+func (c Client) ExpireJobLease(job Job, retryAfter time.Duration) (Job, error) {
+	return c.failAttempt(job, "lease expired", retryAfter, "lease_expires_at <= ?", time.Now().UTC())
+}
+
+// failAttempt records the failure of job's current attempt, as long as the
+// job is still running that attempt and matches where.
+func (c Client) failAttempt(job Job, message string, retryAfter time.Duration, where string, whereArgs ...any) (Job, error) {
+	now := time.Now().UTC()
+	status := JobStatusQueued
+	var completedAt *time.Time
+	if job.Attempts >= job.MaxAttempts {
+		status = JobStatusFailed
+		completedAt = &now
+	}
+
+	query := `
+	UPDATE jobs
+	SET
+		status = ?,
+		completed_at = ?,
+		run_at = ?,
+		leased_by = NULL,
+		lease_expires_at = NULL,
+		last_error = ?,
+		updated_at = ?
+	WHERE id = ? AND status = ? AND attempts = ? AND ` + where
+	args := append([]any{
+		status,
+		completedAt,
+		now.Add(retryAfter),
+		message,
+		now,
+		job.ID,
+		JobStatusRunning,
+		job.Attempts,
+	}, whereArgs...)
+	err := c.execLeased(query, args...)
+	if err != nil {
+		return Job{}, err
+	}
+	return c.GetJob(job.ID)
+}
+
+func (c Client) execLeased(query string, args ...any) error {
+	res, err := c.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrJobLeaseLost
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLeaseAndFailJob(t *testing.T) {
+	forEachMigratedDialect(t, func(t *testing.T, c Client) {
+		enqueued, err := c.EnqueueJob(EnqueueJobParams{Kind: "test", Payload: "{}", MaxAttempts: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		job, err := c.LeaseJob("worker-1", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job == nil || job.ID != enqueued.ID {
+			t.Fatalf("LeaseJob = %+v, want job %s", job, enqueued.ID)
+		}
+		if job.Status != JobStatusRunning || job.Attempts != 1 {
+			t.Errorf("leased job is %s on attempt %d, want running on attempt 1", job.Status, job.Attempts)
+		}
+
+		other, err := c.LeaseJob("worker-2", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if other != nil {
+			t.Fatalf("leased job %s while it was already leased", other.ID)
+		}
+
+		_, err = c.FailJob(job.ID, "worker-2", errors.New("boom"), 0)
+		if !errors.Is(err, ErrJobLeaseLost) {
+			t.Errorf("FailJob by another worker = %v, want ErrJobLeaseLost", err)
+		}
+
+		failed, err := c.FailJob(job.ID, "worker-1", errors.New("boom"), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if failed.Status != JobStatusQueued || failed.CompletedAt != nil {
+			t.Errorf("job after first failure is %s, want queued", failed.Status)
+		}
+		if failed.LastError == nil || *failed.LastError != "boom" {
+			t.Errorf("last error = %v, want boom", failed.LastError)
+		}
+
+		// A lease that runs out without the job finishing isn't leased
+		// again until the attempt is counted as failed.
+		job, err = c.LeaseJob("worker-1", -time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job == nil || job.Attempts != 2 {
+			t.Fatalf("retry lease = %+v, want attempt 2", job)
+		}
+		other, err = c.LeaseJob("worker-2", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if other != nil {
+			t.Fatalf("leased job %s while its expired lease was outstanding", other.ID)
+		}
+
+		expired, err := c.GetExpiredJobLeases()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(expired) != 1 || expired[0].ID != job.ID {
+			t.Fatalf("expired leases = %+v, want job %s", expired, job.ID)
+		}
+		failed, err = c.ExpireJobLease(expired[0], 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if failed.Status != JobStatusFailed || failed.CompletedAt == nil {
+			t.Errorf("job whose last lease expired is %s, want failed with completed_at set", failed.Status)
+		}
+		if failed.LastError == nil || *failed.LastError != "lease expired" {
+			t.Errorf("last error = %v, want lease expired", failed.LastError)
+		}
+		_, err = c.ExpireJobLease(expired[0], 0)
+		if !errors.Is(err, ErrJobLeaseLost) {
+			t.Errorf("expiring the lease twice = %v, want ErrJobLeaseLost", err)
+		}
+		_, err = c.FailJob(job.ID, "worker-1", errors.New("late"), 0)
+		if !errors.Is(err, ErrJobLeaseLost) {
+			t.Errorf("FailJob after the lease expired = %v, want ErrJobLeaseLost", err)
+		}
+
+		job, err = c.LeaseJob("worker-1", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job != nil {
+			t.Errorf("leased failed job %s", job.ID)
+		}
+	})
+}
+
+func TestExpireJobLeaseRetries(t *testing.T) {
+	forEachMigratedDialect(t, func(t *testing.T, c Client) {
+		enqueued, err := c.EnqueueJob(EnqueueJobParams{Kind: "test", Payload: "{}", MaxAttempts: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		job, err := c.LeaseJob("worker-1", -time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job == nil || job.ID != enqueued.ID {
+			t.Fatalf("LeaseJob = %+v, want job %s", job, enqueued.ID)
+		}
+
+		requeued, err := c.ExpireJobLease(*job, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if requeued.Status != JobStatusQueued {
+			t.Errorf("job with attempts left is %s after its lease expired, want queued", requeued.Status)
+		}
+
+		job, err = c.LeaseJob("worker-2", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job == nil || job.Attempts != 2 {
+			t.Fatalf("lease after expiry = %+v, want attempt 2", job)
+		}
+		expired, err := c.GetExpiredJobLeases()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(expired) != 0 {
+			t.Errorf("expired leases = %+v, want none while the lease is current", expired)
+		}
+		_, err = c.ExpireJobLease(*job, 0)
+		if !errors.Is(err, ErrJobLeaseLost) {
+			t.Errorf("expiring a current lease = %v, want ErrJobLeaseLost", err)
+		}
+	})
+}
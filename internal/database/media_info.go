@@ -0,0 +1,95 @@
+package database
+
+import "database/sql"
+
+// MediaInfo describes an uploaded video file as reported by ffprobe.
+type MediaInfo struct {
+	// DurationSeconds is nil if the length of the video isn't known.
+	DurationSeconds *float64 `json:"duration_seconds"`
+	Width           int      `json:"width"`
+	Height          int      `json:"height"`
+	VideoCodec      string   `json:"video_codec"`
+	AudioCodec      string   `json:"audio_codec"`
+	Bitrate         int64    `json:"bitrate"`
+	FrameRate       float64  `json:"frame_rate"`
+	AudioChannels   int      `json:"audio_channels"`
+	ContainerFormat string   `json:"container_format"`
+}
+
+const mediaInfoColumns = `
+		duration_seconds,
+		width,
+		height,
+		video_codec,
+		audio_codec,
+		bitrate,
+		frame_rate,
+		audio_channels,
+		container_format`
+
+// nullMediaInfo scans the media info columns, which are all NULL until the
+// video has been processed. duration_seconds stays NULL afterwards if the
+// duration is unknown.
+type nullMediaInfo struct {
+	durationSeconds sql.NullFloat64
+	width           sql.NullInt64
+	height          sql.NullInt64
+	videoCodec      sql.NullString
+	audioCodec      sql.NullString
+	bitrate         sql.NullInt64
+	frameRate       sql.NullFloat64
+	audioChannels   sql.NullInt64
+	containerFormat sql.NullString
+}
+
+func (n *nullMediaInfo) dest() []any {
+	return []any{
+		&n.durationSeconds,
+		&n.width,
+		&n.height,
+		&n.videoCodec,
+		&n.audioCodec,
+		&n.bitrate,
+		&n.frameRate,
+		&n.audioChannels,
+		&n.containerFormat,
+	}
+}
+
+func (n nullMediaInfo) mediaInfo() *MediaInfo {
+	if !n.width.Valid {
+		return nil
+	}
+	var durationSeconds *float64
+	if n.durationSeconds.Valid {
+		durationSeconds = &n.durationSeconds.Float64
+	}
+	return &MediaInfo{
+		DurationSeconds: durationSeconds,
+		Width:           int(n.width.Int64),
+		Height:          int(n.height.Int64),
+		VideoCodec:      n.videoCodec.String,
+		AudioCodec:      n.audioCodec.String,
+		Bitrate:         n.bitrate.Int64,
+		FrameRate:       n.frameRate.Float64,
+		AudioChannels:   int(n.audioChannels.Int64),
+		ContainerFormat: n.containerFormat.String,
+	}
+}
+
+func mediaInfoArgs(m *MediaInfo) []any {
+	if m == nil {
+		return make([]any, 9)
+	}
+	return []any{
+		m.DurationSeconds,
+		m.Width,
+		m.Height,
+		m.VideoCodec,
+		m.AudioCodec,
+		m.Bitrate,
+		m.FrameRate,
+		m.AudioChannels,
+		m.ContainerFormat,
+	}
+}
@@ -0,0 +1,331 @@
+package database
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// A migration that only works when the database has some optional feature
+// says so in a "-- requires: <feature>" line in its up file.
+var migrationRequires = regexp.MustCompile(`(?m)^-- requires: (\w+)$`)
+
+func migrationDir(d dialect) string {
+	if d == dialectPostgres {
+		return "postgres"
+	}
+	return "sqlite"
+}
+
+type migration struct {
+	Version int
+	Name    string
+	// Requires is the optional feature the migration needs, if any.
+	Requires string
+	up       string
+	down     string
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+	// Missing is the feature the database lacks to apply this migration,
+	// if it lacks one.
+	Missing string
+}
+
+// loadMigrations reads the embedded migrations for d, ordered by version.
+// Every migration needs both an up and a down file.
+func loadMigrations(d dialect) ([]migration, error) {
+	dir := path.Join("migrations", migrationDir(d))
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*migration{}
+	for _, entry := range entries {
+		m := migrationFileName.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("unexpected migration file %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		data, err := migrationFiles.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has files with different names", version)
+		}
+		if m[3] == "up" {
+			mig.up = string(data)
+			if req := migrationRequires.FindStringSubmatch(mig.up); req != nil {
+				mig.Requires = req[1]
+			}
+		} else {
+			mig.down = string(data)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.up == "" || mig.down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both up and down files", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	slices.SortFunc(migrations, func(a, b migration) int {
+		return a.Version - b.Version
+	})
+	return migrations, nil
+}
+
+func (c Client) ensureMigrationsTable() error {
+	exists, err := c.tableExists("schema_migrations")
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	// Databases created before versioned migrations have tables but no
+	// history. Bring them up to the baseline so it can be recorded as run.
+	// Only SQLite was supported then.
+	legacy := false
+	if c.db.dialect == dialectSQLite {
+		legacy, err = c.tableExists("videos")
+		if err != nil {
+			return err
+		}
+	}
+	if legacy {
+		err = c.upgradeLegacySchema()
+		if err != nil {
+			return fmt.Errorf("couldn't upgrade legacy schema: %w", err)
+		}
+	}
+
+	_, err = c.db.Exec(`
+	CREATE TABLE schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at ` + c.db.dialect.timestampType() + ` NOT NULL
+	)
+	`)
+	return err
+}
+
+func (c Client) appliedMigrations() (map[int]time.Time, error) {
+	rows, err := c.db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// Migrate applies every pending migration in order, each in its own
+// transaction, and returns the ones it applied. Migrations needing a
+// feature the database lacks are left pending.
+func (c Client) Migrate() ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(c.db.dialect)
+	if err != nil {
+		return nil, err
+	}
+	err = c.ensureMigrationsTable()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := c.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []MigrationStatus
+	for _, mig := range migrations {
+		supported, err := c.supports(mig.Requires)
+		if err != nil {
+			return ran, err
+		}
+		if _, ok := applied[mig.Version]; ok {
+			if !supported {
+				// Its schema would break writes here, like triggers on
+				// a virtual table whose module isn't compiled in.
+				return ran, fmt.Errorf("migration %d_%s has been applied but needs %s, which this database lacks", mig.Version, mig.Name, mig.Requires)
+			}
+			continue
+		}
+		if !supported {
+			continue
+		}
+		now := time.Now().UTC()
+		err = c.inTx(func(t tx) error {
+			if err := execMigration(t, mig.up); err != nil {
+				return err
+			}
+			_, err := t.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", mig.Version, mig.Name, now)
+			return err
+		})
+		if err != nil {
+			return ran, fmt.Errorf("migration %d_%s failed: %w", mig.Version, mig.Name, err)
+		}
+		ran = append(ran, MigrationStatus{Version: mig.Version, Name: mig.Name, AppliedAt: &now})
+	}
+	return ran, nil
+}
+
+// Rollback reverts the most recently applied migrations, up to steps of
+// them, and returns the ones it reverted.
+func (c Client) Rollback(steps int) ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(c.db.dialect)
+	if err != nil {
+		return nil, err
+	}
+	err = c.ensureMigrationsTable()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := c.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []MigrationStatus
+	for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+		mig := migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		err := c.inTx(func(t tx) error {
+			if err := execMigration(t, mig.down); err != nil {
+				return err
+			}
+			_, err := t.Exec("DELETE FROM schema_migrations WHERE version = ?", mig.Version)
+			return err
+		})
+		if err != nil {
+			return reverted, fmt.Errorf("rollback of %d_%s failed: %w", mig.Version, mig.Name, err)
+		}
+		reverted = append(reverted, MigrationStatus{Version: mig.Version, Name: mig.Name})
+	}
+	return reverted, nil
+}
+
+// MigrationStatuses lists every known migration and when it was applied,
+// if it has been.
+func (c Client) MigrationStatuses() ([]MigrationStatus, error) {
+	migrations, err := loadMigrations(c.db.dialect)
+	if err != nil {
+		return nil, err
+	}
+	exists, err := c.tableExists("schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	applied := map[int]time.Time{}
+	if exists {
+		applied, err = c.appliedMigrations()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, mig := range migrations {
+		status := MigrationStatus{Version: mig.Version, Name: mig.Name}
+		if appliedAt, ok := applied[mig.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		supported, err := c.supports(mig.Requires)
+		if err != nil {
+			return nil, err
+		}
+		if !supported {
+			status.Missing = mig.Requires
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// supports reports whether the database has feature, which is "" for
+// migrations that need nothing special.
+func (c Client) supports(feature string) (bool, error) {
+	switch feature {
+	case "":
+		return true, nil
+	case "fts5":
+		if c.db.dialect != dialectSQLite {
+			return false, nil
+		}
+		var fts5 bool
+		err := c.db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5)
+		return fts5, err
+	default:
+		return false, fmt.Errorf("unknown migration requirement %q", feature)
+	}
+}
+
+// execMigration runs the body of a migration file. It goes straight to the
+// underlying transaction: migrations have no placeholders to rebind, and
+// rebinding would misread apostrophes in comments as opening a string.
+func execMigration(t tx, body string) error {
+	_, err := t.Tx.Exec(body)
+	return err
+}
+
+func (c Client) inTx(fn func(t tx) error) error {
+	t, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer t.Rollback()
+
+	if err := fn(t); err != nil {
+		return err
+	}
+	return t.Commit()
+}
+
+func (c Client) tableExists(table string) (bool, error) {
+	var name string
+	err := c.db.QueryRow(c.db.dialect.tableExistsQuery(), table).Scan(&name)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
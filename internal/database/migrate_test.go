@@ -0,0 +1,118 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestMigrateAndRollback(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		all, err := loadMigrations(c.db.dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Migrations needing a feature this build lacks stay pending.
+		var migrations []migration
+		for _, mig := range all {
+			supported, err := c.supports(mig.Requires)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if supported {
+				migrations = append(migrations, mig)
+			}
+		}
+
+		applied, err := c.Migrate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(applied) != len(migrations) {
+			t.Fatalf("applied %d migrations, want %d", len(applied), len(migrations))
+		}
+		for i, m := range applied {
+			if m.Version != migrations[i].Version {
+				t.Errorf("migration %d applied as version %d, want %d", i, m.Version, migrations[i].Version)
+			}
+		}
+
+		again, err := c.Migrate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(again) != 0 {
+			t.Errorf("second Migrate applied %d migrations, want 0", len(again))
+		}
+
+		statuses, err := c.MigrationStatuses()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range statuses {
+			if s.AppliedAt == nil && s.Missing == "" {
+				t.Errorf("migration %04d_%s not recorded as applied", s.Version, s.Name)
+			}
+			if s.AppliedAt != nil && s.Missing != "" {
+				t.Errorf("migration %04d_%s recorded as applied without %s", s.Version, s.Name, s.Missing)
+			}
+		}
+
+		reverted, err := c.Rollback(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		last := migrations[len(migrations)-1]
+		if len(reverted) != 1 || reverted[0].Version != last.Version {
+			t.Fatalf("Rollback(1) reverted %v, want only version %d", reverted, last.Version)
+		}
+		statuses, err = c.MigrationStatuses()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range statuses {
+			if s.Version == last.Version && s.AppliedAt != nil {
+				t.Errorf("migration %d still recorded as applied after rollback", last.Version)
+			}
+		}
+
+		// Every down migration must undo its up well enough for the whole
+		// history to be replayed.
+		reverted, err = c.Rollback(len(migrations))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(reverted) != len(migrations)-1 {
+			t.Fatalf("rolled back %d more migrations, want %d", len(reverted), len(migrations)-1)
+		}
+		for i, m := range reverted {
+			if want := migrations[len(migrations)-2-i].Version; m.Version != want {
+				t.Errorf("rollback %d reverted version %d, want %d", i, m.Version, want)
+			}
+		}
+		exists, err := c.tableExists("videos")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists {
+			t.Error("videos table still exists after rolling everything back")
+		}
+
+		applied, err = c.Migrate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(applied) != len(migrations) {
+			t.Errorf("re-applied %d migrations, want %d", len(applied), len(migrations))
+		}
+	})
+}
+
+func TestRebind(t *testing.T) {
+	query := "SELECT a FROM t WHERE b = ? AND c = '?' AND d = ?"
+	if got := dialectSQLite.rebind(query); got != query {
+		t.Errorf("SQLite rebind changed the query to %q", got)
+	}
+	want := "SELECT a FROM t WHERE b = $1 AND c = '?' AND d = $2"
+	if got := dialectPostgres.rebind(query); got != want {
+		t.Errorf("PostgreSQL rebind = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,78 @@
+-- The schema as it stood when PostgreSQL support was added. Versions are
+-- kept in step with the SQLite migrations so the same number means the
+-- same change on both.
+
+CREATE TABLE users (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	password TEXT NOT NULL,
+	email TEXT UNIQUE NOT NULL
+);
+
+CREATE TABLE refresh_tokens (
+	token TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMPTZ,
+	user_id TEXT NOT NULL REFERENCES users(id),
+	expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE videos (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	video_url TEXT,
+	user_id TEXT REFERENCES users(id),
+	aspect_ratio TEXT,
+	hls_url TEXT,
+	status TEXT NOT NULL DEFAULT 'draft',
+	status_message TEXT,
+	thumbnails TEXT,
+	previews_url TEXT,
+	visibility TEXT NOT NULL DEFAULT 'private',
+	duration_seconds DOUBLE PRECISION,
+	width INTEGER,
+	height INTEGER,
+	video_codec TEXT,
+	audio_codec TEXT,
+	bitrate BIGINT,
+	frame_rate DOUBLE PRECISION,
+	audio_channels INTEGER,
+	container_format TEXT
+);
+
+CREATE TABLE upload_sessions (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	completed_at TIMESTAMPTZ,
+	video_id TEXT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	user_id TEXT NOT NULL REFERENCES users(id),
+	media_type TEXT NOT NULL,
+	total_size BIGINT NOT NULL,
+	received_size BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE jobs (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	kind TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	user_id TEXT REFERENCES users(id),
+	status TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	max_attempts INTEGER NOT NULL,
+	run_at TIMESTAMPTZ NOT NULL,
+	leased_by TEXT,
+	lease_expires_at TIMESTAMPTZ,
+	last_error TEXT,
+	completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX jobs_runnable ON jobs(status, run_at);
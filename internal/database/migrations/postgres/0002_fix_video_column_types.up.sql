@@ -0,0 +1,4 @@
+-- The PostgreSQL schema never had the wrong column types this migration
+-- fixes for SQLite, so only the index applies.
+
+CREATE INDEX videos_user_id ON videos(user_id, created_at);
@@ -0,0 +1,2 @@
+CREATE INDEX videos_user_id_updated_at ON videos(user_id, updated_at);
+CREATE INDEX videos_user_id_title ON videos(user_id, title);
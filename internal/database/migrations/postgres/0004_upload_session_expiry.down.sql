@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS upload_sessions_expires_at;
+ALTER TABLE upload_sessions DROP COLUMN expires_at;
@@ -0,0 +1,7 @@
+ALTER TABLE upload_sessions ADD COLUMN expires_at TIMESTAMPTZ;
+
+-- Give sessions that predate expiry the default lifetime.
+UPDATE upload_sessions SET expires_at = COALESCE(created_at, CURRENT_TIMESTAMP) + INTERVAL '1 day';
+
+ALTER TABLE upload_sessions ALTER COLUMN expires_at SET NOT NULL;
+CREATE INDEX upload_sessions_expires_at ON upload_sessions(expires_at);
@@ -0,0 +1,2 @@
+DROP INDEX videos_user_id_title;
+CREATE INDEX videos_user_id_title ON videos(user_id, title);
@@ -0,0 +1,4 @@
+-- Titles are listed in byte order, as on SQLite, which needs the C
+-- collation here. Index them the same way so listings can use it.
+DROP INDEX videos_user_id_title;
+CREATE INDEX videos_user_id_title ON videos(user_id, title COLLATE "C");
@@ -0,0 +1,42 @@
+CREATE TABLE videos_new (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	video_url TEXT TEXT,
+	user_id INTEGER REFERENCES users(id),
+	aspect_ratio TEXT,
+	hls_url TEXT,
+	status TEXT NOT NULL DEFAULT 'draft',
+	status_message TEXT,
+	thumbnails TEXT,
+	previews_url TEXT,
+	visibility TEXT NOT NULL DEFAULT 'unlisted',
+	duration_seconds REAL,
+	width INTEGER,
+	height INTEGER,
+	video_codec TEXT,
+	audio_codec TEXT,
+	bitrate INTEGER,
+	frame_rate REAL,
+	audio_channels INTEGER,
+	container_format TEXT
+);
+
+INSERT INTO videos_new (
+	id, created_at, updated_at, title, description, thumbnail_url, video_url,
+	user_id, aspect_ratio, hls_url, status, status_message, thumbnails,
+	previews_url, visibility, duration_seconds, width, height, video_codec,
+	audio_codec, bitrate, frame_rate, audio_channels, container_format
+)
+SELECT
+	id, created_at, updated_at, title, description, thumbnail_url, video_url,
+	user_id, aspect_ratio, hls_url, status, status_message, thumbnails,
+	previews_url, visibility, duration_seconds, width, height, video_codec,
+	audio_codec, bitrate, frame_rate, audio_channels, container_format
+FROM videos;
+
+DROP TABLE videos;
+ALTER TABLE videos_new RENAME TO videos;
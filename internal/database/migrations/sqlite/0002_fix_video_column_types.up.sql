@@ -0,0 +1,48 @@
+-- SQLite can't change column types in place, so videos is rebuilt to fix
+-- video_url's doubled type and user_id's INTEGER type (user IDs are UUID
+-- strings). New videos now default to private at the schema level too.
+
+CREATE TABLE videos_new (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	video_url TEXT,
+	user_id TEXT REFERENCES users(id),
+	aspect_ratio TEXT,
+	hls_url TEXT,
+	status TEXT NOT NULL DEFAULT 'draft',
+	status_message TEXT,
+	thumbnails TEXT,
+	previews_url TEXT,
+	visibility TEXT NOT NULL DEFAULT 'private',
+	duration_seconds REAL,
+	width INTEGER,
+	height INTEGER,
+	video_codec TEXT,
+	audio_codec TEXT,
+	bitrate INTEGER,
+	frame_rate REAL,
+	audio_channels INTEGER,
+	container_format TEXT
+);
+
+INSERT INTO videos_new (
+	id, created_at, updated_at, title, description, thumbnail_url, video_url,
+	user_id, aspect_ratio, hls_url, status, status_message, thumbnails,
+	previews_url, visibility, duration_seconds, width, height, video_codec,
+	audio_codec, bitrate, frame_rate, audio_channels, container_format
+)
+SELECT
+	id, created_at, updated_at, title, description, thumbnail_url, video_url,
+	user_id, aspect_ratio, hls_url, status, status_message, thumbnails,
+	previews_url, visibility, duration_seconds, width, height, video_codec,
+	audio_codec, bitrate, frame_rate, audio_channels, container_format
+FROM videos;
+
+DROP TABLE videos;
+ALTER TABLE videos_new RENAME TO videos;
+
+CREATE INDEX videos_user_id ON videos(user_id, created_at);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS videos_user_id_title;
+DROP INDEX IF EXISTS videos_user_id_updated_at;
@@ -0,0 +1,8 @@
+-- Videos used to be created with CURRENT_TIMESTAMP, which SQLite stores as
+-- "YYYY-MM-DD HH:MM:SS" while times bound from Go carry a "+00:00" suffix.
+-- Listing pages compare these as text, so bring old rows into the Go form.
+UPDATE videos SET created_at = created_at || '+00:00' WHERE length(created_at) = 19;
+UPDATE videos SET updated_at = updated_at || '+00:00' WHERE length(updated_at) = 19;
+
+CREATE INDEX videos_user_id_updated_at ON videos(user_id, updated_at);
+CREATE INDEX videos_user_id_title ON videos(user_id, title);
@@ -0,0 +1,6 @@
+ALTER TABLE upload_sessions ADD COLUMN expires_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00';
+
+-- Give sessions that predate expiry the default lifetime.
+UPDATE upload_sessions SET expires_at = COALESCE(datetime(created_at, '+1 day'), datetime('now', '+1 day'));
+
+CREATE INDEX upload_sessions_expires_at ON upload_sessions(expires_at);
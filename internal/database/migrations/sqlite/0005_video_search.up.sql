@@ -0,0 +1,35 @@
+-- requires: fts5
+-- go-sqlite3 only compiles in FTS5 with the sqlite_fts5 build tag. Without
+-- it this migration stays pending and search matches substrings instead.
+
+-- videos_fts carries the video ID as an unindexed column rather than
+-- sharing rowids, which VACUUM is free to renumber on a table with a text
+-- primary key.
+CREATE VIRTUAL TABLE IF NOT EXISTS videos_fts USING fts5(
+	id UNINDEXED,
+	title,
+	description,
+	tokenize = 'unicode61 remove_diacritics 2'
+);
+
+-- Rebuilding the videos table drops these, so migrations that do must
+-- create them again.
+CREATE TRIGGER IF NOT EXISTS videos_fts_insert AFTER INSERT ON videos BEGIN
+	INSERT INTO videos_fts (id, title, description)
+	VALUES (new.id, new.title, COALESCE(new.description, ''));
+END;
+
+CREATE TRIGGER IF NOT EXISTS videos_fts_update AFTER UPDATE OF title, description ON videos BEGIN
+	DELETE FROM videos_fts WHERE id = old.id;
+	INSERT INTO videos_fts (id, title, description)
+	VALUES (new.id, new.title, COALESCE(new.description, ''));
+END;
+
+CREATE TRIGGER IF NOT EXISTS videos_fts_delete AFTER DELETE ON videos BEGIN
+	DELETE FROM videos_fts WHERE id = old.id;
+END;
+
+-- Earlier builds created the index at start-up, so it may already exist.
+DELETE FROM videos_fts;
+INSERT INTO videos_fts (id, title, description)
+SELECT id, title, COALESCE(description, '') FROM videos;
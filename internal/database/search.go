@@ -0,0 +1,163 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Matched terms in search snippets are wrapped in these markers, which
+// can't appear in normal text, so callers can escape the rest safely.
+const (
+	HighlightStart = "\x02"
+	HighlightEnd   = "\x03"
+)
+
+// searchIndexed reports whether the FTS5 index from the video_search
+// migration is in place. PostgreSQL, and SQLite built without the
+// sqlite_fts5 tag, don't have one and search by substring instead.
+func (c Client) searchIndexed() (bool, error) {
+	if c.db.dialect != dialectSQLite {
+		return false, nil
+	}
+	var name string
+	err := c.db.QueryRow("SELECT name FROM sqlite_master WHERE type = 'trigger' AND name = 'videos_fts_insert'").Scan(&name)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+type VideoSearchResult struct {
+	Video
+	// Rank orders results: lower is a better match. It is only meaningful
+	// relative to other results of the same search.
+	Rank               float64
+	TitleSnippet       string
+	DescriptionSnippet string
+}
+
+type SearchVideosParams struct {
+	Query string
+	// ViewerID is the user searching, or uuid.Nil for anonymous searches.
+	// Results are the viewer's own videos and other users' public, ready
+	// videos.
+	ViewerID uuid.UUID
+	Limit    int
+}
+
+// SearchVideos finds videos whose title or description match every word of
+// params.Query, the last word as a prefix, best matches first.
+func (c Client) SearchVideos(params SearchVideosParams) ([]VideoSearchResult, error) {
+	terms := strings.Fields(params.Query)
+	if len(terms) == 0 {
+		return []VideoSearchResult{}, nil
+	}
+
+	indexed, err := c.searchIndexed()
+	if err != nil {
+		return nil, err
+	}
+	if !indexed {
+		return c.searchVideosLike(terms, params)
+	}
+
+	// Quote every term so punctuation in the query can't be read as FTS5
+	// syntax.
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	match := strings.Join(quoted, " ") + "*"
+
+	query := `
+	SELECT ` + videoColumns + `,
+		matches.score,
+		matches.title_snippet,
+		matches.description_snippet
+	FROM (
+		SELECT
+			id AS video_id,
+			bm25(videos_fts, 0, 10, 1) AS score,
+			snippet(videos_fts, 1, ?, ?, '…', 16) AS title_snippet,
+			snippet(videos_fts, 2, ?, ?, '…', 24) AS description_snippet
+		FROM videos_fts
+		WHERE videos_fts MATCH ?
+	) AS matches
+	JOIN videos ON videos.id = matches.video_id
+	WHERE user_id = ? OR (visibility = ? AND status = ?)
+	ORDER BY matches.score
+	LIMIT ?
+	`
+	return c.queryVideoSearchResults(
+		query,
+		HighlightStart, HighlightEnd,
+		HighlightStart, HighlightEnd,
+		match,
+		params.ViewerID,
+		VideoVisibilityPublic,
+		VideoStatusReady,
+		params.Limit,
+	)
+}
+
+// searchVideosLike is SearchVideos without a full-text index. Matches are
+// neither ranked nor highlighted; the newest come first.
+func (c Client) searchVideosLike(terms []string, params SearchVideosParams) ([]VideoSearchResult, error) {
+	where := []string{"(user_id = ? OR (visibility = ? AND status = ?))"}
+	args := []any{params.ViewerID, VideoVisibilityPublic, VideoStatusReady}
+	for _, term := range terms {
+		pattern := "%" + escapeLike(strings.ToLower(term)) + "%"
+		where = append(where, `(LOWER(title) LIKE ? ESCAPE '\' OR LOWER(COALESCE(description, '')) LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern)
+	}
+
+	query := `
+	SELECT ` + videoColumns + `, 0, title, COALESCE(description, '')
+	FROM videos
+	WHERE ` + strings.Join(where, " AND ") + `
+	ORDER BY created_at DESC
+	LIMIT ?
+	`
+	return c.queryVideoSearchResults(query, append(args, params.Limit)...)
+}
+
+func (c Client) queryVideoSearchResults(query string, args ...any) ([]VideoSearchResult, error) {
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []VideoSearchResult{}
+	for rows.Next() {
+		var result VideoSearchResult
+		result.Video, err = scanVideo(withExtraColumns{rows, []any{
+			&result.Rank,
+			&result.TitleSnippet,
+			&result.DescriptionSnippet,
+		}})
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// withExtraColumns scans columns selected after the video's own into extra.
+type withExtraColumns struct {
+	rowScanner
+	extra []any
+}
+
+func (s withExtraColumns) Scan(dest ...any) error {
+	return s.rowScanner.Scan(append(dest, s.extra...)...)
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSearchVideos(t *testing.T) {
+	forEachMigratedDialect(t, func(t *testing.T, c Client) {
+		// With FTS5 the video_search migration indexes videos; without
+		// it search falls back to substring matching, which this test
+		// covers just the same.
+		fts5, err := c.supports("fts5")
+		if err != nil {
+			t.Fatal(err)
+		}
+		indexed, err := c.searchIndexed()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if indexed != fts5 {
+			t.Fatalf("search indexed = %v with FTS5 support %v", indexed, fts5)
+		}
+
+		owner := createTestUser(t, c, "owner@example.com")
+		other := createTestUser(t, c, "other@example.com")
+
+		create := func(user *User, title, description string) Video {
+			t.Helper()
+			video, err := c.CreateVideo(CreateVideoParams{Title: title, Description: description, UserID: user.ID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return video
+		}
+		pasta := create(owner, "Cooking pasta", "An Italian dinner")
+		create(owner, "Gardening tips", "Growing basil for pasta sauce")
+		create(other, "Secret pasta", "Nobody else should find this")
+
+		search := func(query string) []string {
+			t.Helper()
+			results, err := c.SearchVideos(SearchVideosParams{Query: query, ViewerID: owner.ID, Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var titles []string
+			for _, result := range results {
+				titles = append(titles, result.Title)
+			}
+			slices.Sort(titles)
+			return titles
+		}
+		tests := []struct {
+			query string
+			want  []string
+		}{
+			{"pasta", []string{"Cooking pasta", "Gardening tips"}},
+			{"italian din", []string{"Cooking pasta"}},
+			{"basil tips", []string{"Gardening tips"}},
+			{"secret", nil},
+		}
+		for _, tt := range tests {
+			if got := search(tt.query); !slices.Equal(got, tt.want) {
+				t.Errorf("search for %q found %q, want %q", tt.query, got, tt.want)
+			}
+		}
+
+		// Edits and deletes reach the index.
+		pasta.Title = "Cooking risotto"
+		if err := c.UpdateVideo(pasta); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := search("risotto"), []string{"Cooking risotto"}; !slices.Equal(got, want) {
+			t.Errorf("search after renaming found %q, want %q", got, want)
+		}
+		if err := c.DeleteVideo(pasta.ID); err != nil {
+			t.Fatal(err)
+		}
+		if got := search("risotto"); got != nil {
+			t.Errorf("search after deleting found %q", got)
+		}
+	})
+}
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+type ThumbnailVariant struct {
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	URL    string `json:"url"`
+}
+
+// Thumbnails lists the resized copies of a video's thumbnail by format,
+// narrowest first. It is stored as JSON in the videos.thumbnails column.
+type Thumbnails struct {
+	JPEG []ThumbnailVariant `json:"jpeg"`
+	WebP []ThumbnailVariant `json:"webp"`
+}
+
+func (t *Thumbnails) Scan(src any) error {
+	switch v := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), t)
+	case []byte:
+		return json.Unmarshal(v, t)
+	default:
+		return fmt.Errorf("can't scan %T into Thumbnails", src)
+	}
+}
+
+func (t Thumbnails) Value() (driver.Value, error) {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
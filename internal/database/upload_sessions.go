@@ -0,0 +1,195 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrUploadOffsetMismatch = errors.New("upload offset does not match")
+
+type UploadSession struct {
+	ID           uuid.UUID  `json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	CompletedAt  *time.Time `json:"completed_at"`
+	ReceivedSize int64      `json:"received_size"`
+	CreateUploadSessionParams
+}
+
+// Expired reports whether the session ran out of time before it was
+// completed.
+func (s UploadSession) Expired(now time.Time) bool {
+	return s.CompletedAt == nil && now.After(s.ExpiresAt)
+}
+
+type CreateUploadSessionParams struct {
+	VideoID   uuid.UUID `json:"video_id"`
+	UserID    uuid.UUID `json:"user_id"`
+	MediaType string    `json:"media_type"`
+	TotalSize int64     `json:"total_size"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (c Client) CreateUploadSession(params CreateUploadSessionParams) (UploadSession, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO upload_sessions (
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		user_id,
+		media_type,
+		total_size,
+		received_size,
+		expires_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, 0, ?)
+	`
+	now := time.Now().UTC()
+	_, err := c.db.Exec(query, id, now, now, params.VideoID, params.UserID, params.MediaType, params.TotalSize, params.ExpiresAt.UTC())
+	if err != nil {
+		return UploadSession{}, err
+	}
+
+	return c.GetUploadSession(id)
+}
+
+const uploadSessionColumns = `
+	id,
+	created_at,
+	updated_at,
+	completed_at,
+	video_id,
+	user_id,
+	media_type,
+	total_size,
+	received_size,
+	expires_at
+`
+
+func scanUploadSession(row rowScanner) (UploadSession, error) {
+	var session UploadSession
+	err := row.Scan(
+		&session.ID,
+		&session.CreatedAt,
+		&session.UpdatedAt,
+		&session.CompletedAt,
+		&session.VideoID,
+		&session.UserID,
+		&session.MediaType,
+		&session.TotalSize,
+		&session.ReceivedSize,
+		&session.ExpiresAt,
+	)
+	return session, err
+}
+
+func (c Client) GetUploadSession(id uuid.UUID) (UploadSession, error) {
+	query := `SELECT ` + uploadSessionColumns + ` FROM upload_sessions WHERE id = ?`
+	session, err := scanUploadSession(c.db.QueryRow(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return UploadSession{}, nil
+		}
+		return UploadSession{}, err
+	}
+
+	return session, nil
+}
+
+// GetExpiredUploadSessions returns the sessions whose expiry has passed,
+// completed or not.
+func (c Client) GetExpiredUploadSessions(now time.Time) ([]UploadSession, error) {
+	query := `SELECT ` + uploadSessionColumns + ` FROM upload_sessions WHERE expires_at < ?`
+	return c.queryUploadSessions(query, now.UTC())
+}
+
+// GetOpenUploadSessions returns the video's sessions that haven't been
+// completed, including expired ones.
+func (c Client) GetOpenUploadSessions(videoID uuid.UUID) ([]UploadSession, error) {
+	query := `SELECT ` + uploadSessionColumns + ` FROM upload_sessions WHERE video_id = ? AND completed_at IS NULL`
+	return c.queryUploadSessions(query, videoID)
+}
+
+func (c Client) queryUploadSessions(query string, args ...any) ([]UploadSession, error) {
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []UploadSession{}
+	for rows.Next() {
+		session, err := scanUploadSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// AdvanceUploadSession moves the received offset of a session from
+// fromOffset to toOffset. It fails with ErrUploadOffsetMismatch when another
+// request has moved the offset in the meantime.
+func (c Client) AdvanceUploadSession(id uuid.UUID, fromOffset, toOffset int64) error {
+	query := `
+	UPDATE upload_sessions
+	SET
+		received_size = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND received_size = ? AND completed_at IS NULL
+	`
+	res, err := c.db.Exec(query, toOffset, id, fromOffset)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUploadOffsetMismatch
+	}
+	return nil
+}
+
+func (c Client) CompleteUploadSession(id uuid.UUID) error {
+	query := `
+	UPDATE upload_sessions
+	SET
+		completed_at = CURRENT_TIMESTAMP,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, id)
+	return err
+}
+
+// ReopenUploadSession undoes CompleteUploadSession.
+func (c Client) ReopenUploadSession(id uuid.UUID) error {
+	query := `
+	UPDATE upload_sessions
+	SET
+		completed_at = NULL,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, id)
+	return err
+}
+
+func (c Client) DeleteUploadSession(id uuid.UUID) error {
+	query := `
+	DELETE FROM upload_sessions
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, id)
+	return err
+}
@@ -3,43 +3,263 @@ package database
 import (
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type VideoStatus string
+
+const (
+	VideoStatusDraft      VideoStatus = "draft"
+	VideoStatusUploading  VideoStatus = "uploading"
+	VideoStatusProcessing VideoStatus = "processing"
+	VideoStatusReady      VideoStatus = "ready"
+	VideoStatusFailed     VideoStatus = "failed"
+)
+
+// videoStatusTransitions lists the statuses a video may move to from each
+// status. Starting a new upload is allowed from any status except while a
+// previous upload is still being processed.
+var videoStatusTransitions = map[VideoStatus][]VideoStatus{
+	VideoStatusDraft:      {VideoStatusUploading, VideoStatusProcessing},
+	VideoStatusUploading:  {VideoStatusUploading, VideoStatusProcessing, VideoStatusFailed},
+	VideoStatusProcessing: {VideoStatusReady, VideoStatusFailed},
+	VideoStatusReady:      {VideoStatusUploading, VideoStatusProcessing},
+	VideoStatusFailed:     {VideoStatusUploading, VideoStatusProcessing},
+}
+
+var ErrInvalidVideoStatusTransition = errors.New("invalid video status transition")
+
+func (s VideoStatus) Valid() bool {
+	_, ok := videoStatusTransitions[s]
+	return ok
+}
+
+// CanTransitionTo reports whether a video in status s may move to next.
+func (s VideoStatus) CanTransitionTo(next VideoStatus) bool {
+	for _, to := range videoStatusTransitions[s] {
+		if to == next {
+			return true
+		}
+	}
+	return false
+}
+
+type VideoVisibility string
+
+const (
+	// VideoVisibilityPrivate videos are only available to their owner.
+	VideoVisibilityPrivate VideoVisibility = "private"
+	// VideoVisibilityUnlisted videos are available to anyone with the link.
+	VideoVisibilityUnlisted VideoVisibility = "unlisted"
+	// VideoVisibilityPublic videos are also listed publicly.
+	VideoVisibilityPublic VideoVisibility = "public"
+)
+
+func (v VideoVisibility) Valid() bool {
+	switch v {
+	case VideoVisibilityPrivate, VideoVisibilityUnlisted, VideoVisibilityPublic:
+		return true
+	}
+	return false
+}
+
 type Video struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	ThumbnailURL *string   `json:"thumbnail_url"`
-	VideoURL     *string   `json:"video_url"`
+	ID            uuid.UUID   `json:"id"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+	ThumbnailURL  *string     `json:"thumbnail_url"`
+	Thumbnails    *Thumbnails `json:"thumbnails"`
+	VideoURL      *string     `json:"video_url"`
+	HLSURL        *string     `json:"hls_url"`
+	PreviewsURL   *string     `json:"previews_url"`
+	AspectRatio   *string     `json:"aspect_ratio"`
+	MediaInfo     *MediaInfo  `json:"media_info"`
+	Status        VideoStatus `json:"status"`
+	StatusMessage *string     `json:"status_message"`
 	CreateVideoParams
 }
 
 type CreateVideoParams struct {
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	UserID      uuid.UUID `json:"user_id"`
+	Title       string          `json:"title"`
+	Description string          `json:"description"`
+	Visibility  VideoVisibility `json:"visibility"`
+	UserID      uuid.UUID       `json:"user_id"`
 }
 
-func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
-	query := `
-	SELECT
+const videoColumns = `
 		id,
 		created_at,
 		updated_at,
 		title,
 		description,
 		thumbnail_url,
+		thumbnails,
 		video_url,
-		user_id
+		hls_url,
+		previews_url,
+		aspect_ratio,
+		status,
+		status_message,
+		visibility,
+		user_id,` + mediaInfoColumns
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanVideo(row rowScanner) (Video, error) {
+	var (
+		video     Video
+		mediaInfo nullMediaInfo
+	)
+	dest := []any{
+		&video.ID,
+		&video.CreatedAt,
+		&video.UpdatedAt,
+		&video.Title,
+		&video.Description,
+		&video.ThumbnailURL,
+		&video.Thumbnails,
+		&video.VideoURL,
+		&video.HLSURL,
+		&video.PreviewsURL,
+		&video.AspectRatio,
+		&video.Status,
+		&video.StatusMessage,
+		&video.Visibility,
+		&video.UserID,
+	}
+	err := row.Scan(append(dest, mediaInfo.dest()...)...)
+	video.MediaInfo = mediaInfo.mediaInfo()
+	return video, err
+}
+
+type VideoSort string
+
+const (
+	VideoSortCreatedAt VideoSort = "created_at"
+	VideoSortUpdatedAt VideoSort = "updated_at"
+	VideoSortTitle     VideoSort = "title"
+)
+
+func (s VideoSort) Valid() bool {
+	switch s {
+	case VideoSortCreatedAt, VideoSortUpdatedAt, VideoSortTitle:
+		return true
+	}
+	return false
+}
+
+// sortValue returns the video's value for the sort column.
+func (s VideoSort) sortValue(video Video) any {
+	switch s {
+	case VideoSortUpdatedAt:
+		return video.UpdatedAt
+	case VideoSortTitle:
+		return video.Title
+	default:
+		return video.CreatedAt
+	}
+}
+
+type ListVideosParams struct {
+	UserID uuid.UUID
+	// Status, if set, only lists videos in that status.
+	Status VideoStatus
+	// Search, if set, only lists videos whose title or description contains
+	// it, ignoring case.
+	Search     string
+	Sort       VideoSort
+	Descending bool
+	Limit      int
+	// After, if set, is the last video of the previous page. Only its ID and
+	// the field being sorted on are used.
+	After *Video
+}
+
+// ListVideos returns a page of the user's videos, ordered by params.Sort
+// with ties broken by ID, and whether more videos follow it. Titles sort
+// byte by byte, so uppercase before lowercase, on every database.
+func (c Client) ListVideos(params ListVideosParams) ([]Video, bool, error) {
+	if !params.Sort.Valid() {
+		params.Sort = VideoSortCreatedAt
+	}
+	column := string(params.Sort)
+	if params.Sort == VideoSortTitle {
+		column = c.db.dialect.collateBytewise(column)
+	}
+	direction, comparison := "ASC", ">"
+	if params.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	where := []string{"user_id = ?"}
+	args := []any{params.UserID}
+	if params.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, params.Status)
+	}
+	if params.Search != "" {
+		pattern := "%" + escapeLike(strings.ToLower(params.Search)) + "%"
+		where = append(where, `(LOWER(title) LIKE ? ESCAPE '\' OR LOWER(COALESCE(description, '')) LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern)
+	}
+	if params.After != nil {
+		value := params.Sort.sortValue(*params.After)
+		where = append(where, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", column, comparison))
+		args = append(args, value, value, params.After.ID)
+	}
+
+	query := `
+	SELECT ` + videoColumns + `
+	FROM videos
+	WHERE ` + strings.Join(where, " AND ") + `
+	ORDER BY ` + column + ` ` + direction + `, id ` + direction + `
+	LIMIT ?
+	`
+	// Ask for one extra row to find out whether there's another page.
+	args = append(args, params.Limit+1)
+	videos, err := c.queryVideos(query, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(videos) > params.Limit {
+		return videos[:params.Limit], true, nil
+	}
+	return videos, false, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// GetPublicVideos returns every public video that is ready to watch,
+// newest first.
+func (c Client) GetPublicVideos() ([]Video, error) {
+	query := `
+	SELECT ` + videoColumns + `
 	FROM videos
-	WHERE user_id = ?
+	WHERE visibility = ? AND status = ?
 	ORDER BY created_at DESC
 	`
+	return c.queryVideos(query, VideoVisibilityPublic, VideoStatusReady)
+}
 
-	rows, err := c.db.Query(query, userID)
+func (c Client) GetAllVideos() ([]Video, error) {
+	query := `
+	SELECT ` + videoColumns + `
+	FROM videos
+	ORDER BY created_at
+	`
+	return c.queryVideos(query)
+}
+
+func (c Client) queryVideos(query string, args ...any) ([]Video, error) {
+	rows, err := c.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -47,27 +267,24 @@ func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 
 	videos := []Video{}
 	for rows.Next() {
-		var video Video
-		if err := rows.Scan(
-			&video.ID,
-			&video.CreatedAt,
-			&video.UpdatedAt,
-			&video.Title,
-			&video.Description,
-			&video.ThumbnailURL,
-			&video.VideoURL,
-			&video.UserID,
-		); err != nil {
+		video, err := scanVideo(rows)
+		if err != nil {
 			return nil, err
 		}
 		videos = append(videos, video)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
 	return videos, nil
 }
 
 func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 	id := uuid.New()
+	if params.Visibility == "" {
+		params.Visibility = VideoVisibilityPrivate
+	}
 	query := `
 	INSERT INTO videos (
 		id,
@@ -75,10 +292,13 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 		updated_at,
 		title,
 		description,
+		status,
+		visibility,
 		user_id
-	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, id, params.Title, params.Description, params.UserID)
+	now := time.Now().UTC()
+	_, err := c.db.Exec(query, id, now, now, params.Title, params.Description, VideoStatusDraft, params.Visibility, params.UserID)
 	if err != nil {
 		return Video{}, err
 	}
@@ -88,29 +308,12 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 
 func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
+	SELECT ` + videoColumns + `
 	FROM videos
 	WHERE id = ?
 	`
 
-	var video Video
-	err := c.db.QueryRow(query, id).Scan(
-		&video.ID,
-		&video.CreatedAt,
-		&video.UpdatedAt,
-		&video.Title,
-		&video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
-		&video.UserID)
+	video, err := scanVideo(c.db.QueryRow(query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Video{}, nil
@@ -121,30 +324,169 @@ func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 	return video, nil
 }
 
+// GetVideosByAssetName returns the videos whose file or thumbnail is stored
+// under the random asset name, in whatever form its URL was saved.
+func (c Client) GetVideosByAssetName(name string) ([]Video, error) {
+	pattern := "%" + escapeLike(name) + "%"
+	query := `
+	SELECT ` + videoColumns + `
+	FROM videos
+	WHERE video_url LIKE ? ESCAPE '\' OR thumbnail_url LIKE ? ESCAPE '\'
+	`
+	return c.queryVideos(query, pattern, pattern)
+}
+
+var ErrVideoModified = errors.New("video was modified")
+
+// UpdateVideo saves every field of video and bumps its updated_at.
 func (c Client) UpdateVideo(video Video) error {
+	_, err := c.updateVideo(video, "id = ?", video.ID)
+	return err
+}
+
+// UpdateVideoIfUnmodified is UpdateVideo for read-modify-write cycles: it
+// returns ErrVideoModified instead of saving if the video's updated_at no
+// longer matches the updatedAt it was read with, or the video is gone.
+func (c Client) UpdateVideoIfUnmodified(video Video, updatedAt time.Time) error {
+	res, err := c.updateVideo(video, "id = ? AND updated_at = ?", video.ID, updatedAt.UTC())
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrVideoModified
+	}
+	return nil
+}
+
+// updateVideo saves every field of video to the rows matching where.
+func (c Client) updateVideo(video Video, where string, whereArgs ...any) (sql.Result, error) {
 	query := `
 	UPDATE videos
 	SET
+		updated_at = ?,
 		title = ?,
 		description = ?,
 		thumbnail_url = ?,
+		thumbnails = ?,
 		video_url = ?,
-		user_id = ?
-	WHERE id = ?
-	`
+		hls_url = ?,
+		previews_url = ?,
+		aspect_ratio = ?,
+		visibility = ?,
+		user_id = ?,
+		duration_seconds = ?,
+		width = ?,
+		height = ?,
+		video_codec = ?,
+		audio_codec = ?,
+		bitrate = ?,
+		frame_rate = ?,
+		audio_channels = ?,
+		container_format = ?
+	WHERE ` + where
 
-	_, err := c.db.Exec(
-		query,
+	args := []any{
+		time.Now().UTC(),
 		video.Title,
 		video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
+		video.ThumbnailURL,
+		video.Thumbnails,
+		video.VideoURL,
+		video.HLSURL,
+		video.PreviewsURL,
+		video.AspectRatio,
+		video.Visibility,
 		video.UserID,
-		video.ID,
-	)
+	}
+	args = append(args, mediaInfoArgs(video.MediaInfo)...)
+	args = append(args, whereArgs...)
+	return c.db.Exec(query, args...)
+}
+
+func (c Client) SetVideoThumbnail(id uuid.UUID, thumbnailURL string, thumbnails *Thumbnails) error {
+	query := `
+	UPDATE videos
+	SET thumbnail_url = ?, thumbnails = ?, updated_at = ?
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, thumbnailURL, thumbnails, time.Now().UTC(), id)
 	return err
 }
 
+// SetVideoThumbnailIfUnset records a thumbnail on the video unless it
+// already has one, and reports whether it did.
+func (c Client) SetVideoThumbnailIfUnset(id uuid.UUID, thumbnailURL string, thumbnails *Thumbnails) (bool, error) {
+	query := `
+	UPDATE videos
+	SET thumbnail_url = ?, thumbnails = ?, updated_at = ?
+	WHERE id = ? AND thumbnail_url IS NULL
+	`
+	res, err := c.db.Exec(query, thumbnailURL, thumbnails, time.Now().UTC(), id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// SetVideoStatus moves a video to status, recording message alongside it
+// (an empty message clears it). It returns ErrInvalidVideoStatusTransition
+// if the video's current status doesn't allow the move, and sql.ErrNoRows if
+// the video doesn't exist.
+func (c Client) SetVideoStatus(id uuid.UUID, status VideoStatus, message string) error {
+	var from []any
+	for s := range videoStatusTransitions {
+		if s.CanTransitionTo(status) {
+			from = append(from, s)
+		}
+	}
+	if len(from) == 0 {
+		return fmt.Errorf("%w: nothing may move to %q", ErrInvalidVideoStatusTransition, status)
+	}
+
+	var statusMessage *string
+	if message != "" {
+		statusMessage = &message
+	}
+
+	query := `
+	UPDATE videos
+	SET
+		status = ?,
+		status_message = ?,
+		updated_at = ?
+	WHERE id = ? AND status IN (?` + strings.Repeat(", ?", len(from)-1) + `)
+	`
+	args := append([]any{status, statusMessage, time.Now().UTC(), id}, from...)
+	res, err := c.db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+
+	video, err := c.GetVideo(id)
+	if err != nil {
+		return err
+	}
+	if video.ID == uuid.Nil {
+		return sql.ErrNoRows
+	}
+	return fmt.Errorf("%w: %s to %s", ErrInvalidVideoStatusTransition, video.Status, status)
+}
+
 func (c Client) DeleteVideo(id uuid.UUID) error {
 	query := `
 	DELETE FROM videos
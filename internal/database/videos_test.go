@@ -0,0 +1,122 @@
+package database
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestCreateAndListVideos(t *testing.T) {
+	forEachMigratedDialect(t, func(t *testing.T, c Client) {
+		owner := createTestUser(t, c, "owner@example.com")
+		other := createTestUser(t, c, "other@example.com")
+
+		titles := []string{"Delta", "alpha", "Charlie", "bravo", "Echo 100%"}
+		for _, title := range titles {
+			video, err := c.CreateVideo(CreateVideoParams{
+				Title:       title,
+				Description: "about " + title,
+				UserID:      owner.ID,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if video.ID == uuid.Nil || video.Title != title {
+				t.Fatalf("CreateVideo returned %+v", video)
+			}
+			if video.Status != VideoStatusDraft || video.Visibility != VideoVisibilityPrivate {
+				t.Errorf("new video is %s and %s, want draft and private", video.Status, video.Visibility)
+			}
+		}
+		_, err := c.CreateVideo(CreateVideoParams{Title: "Foxtrot", UserID: other.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Page through by title two at a time.
+		var listed []string
+		params := ListVideosParams{UserID: owner.ID, Sort: VideoSortTitle, Limit: 2}
+		for page := 0; ; page++ {
+			if page > len(titles) {
+				t.Fatal("pagination doesn't end")
+			}
+			videos, more, err := c.ListVideos(params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, video := range videos {
+				listed = append(listed, video.Title)
+			}
+			if !more {
+				break
+			}
+			params.After = &videos[len(videos)-1]
+		}
+		// Titles sort byte by byte on every database, as slices.Sort does.
+		want := slices.Clone(titles)
+		slices.Sort(want)
+		if !slices.Equal(listed, want) {
+			t.Errorf("listed %q by title, want %q", listed, want)
+		}
+
+		// Newest first, reading three at a time gives the same order as reading
+		// everything at once.
+		all, more, err := c.ListVideos(ListVideosParams{UserID: owner.ID, Descending: true, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if more || len(all) != len(titles) {
+			t.Fatalf("listed %d videos (more: %v), want %d", len(all), more, len(titles))
+		}
+		for i := 1; i < len(all); i++ {
+			if all[i].CreatedAt.After(all[i-1].CreatedAt) {
+				t.Errorf("%q listed after %q but created later", all[i].Title, all[i-1].Title)
+			}
+		}
+		var paged []uuid.UUID
+		params = ListVideosParams{UserID: owner.ID, Descending: true, Limit: 3}
+		for {
+			videos, more, err := c.ListVideos(params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, video := range videos {
+				paged = append(paged, video.ID)
+			}
+			if !more {
+				break
+			}
+			params.After = &videos[len(videos)-1]
+		}
+		var ids []uuid.UUID
+		for _, video := range all {
+			ids = append(ids, video.ID)
+		}
+		if !slices.Equal(paged, ids) {
+			t.Errorf("paging by created_at listed %v, want %v", paged, ids)
+		}
+
+		// Search ignores case and treats LIKE wildcards literally.
+		for query, want := range map[string][]string{
+			"ALPHA": {"alpha"},
+			"100%":  {"Echo 100%"},
+			"%":     {"Echo 100%"},
+			"about": titles,
+		} {
+			videos, _, err := c.ListVideos(ListVideosParams{UserID: owner.ID, Search: query, Sort: VideoSortTitle, Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, video := range videos {
+				got = append(got, video.Title)
+			}
+			want = slices.Clone(want)
+			slices.Sort(want)
+			if !slices.Equal(got, want) {
+				t.Errorf("search %q listed %q, want %q", query, got, want)
+			}
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+type Format string
+
+const (
+	FormatJPEG Format = "jpeg"
+	FormatWebP Format = "webp"
+)
+
+// MediaType returns the MIME type of images encoded in format f.
+func (f Format) MediaType() string {
+	return "image/" + string(f)
+}
+
+// Ext returns the file extension, with its dot, for format f.
+func (f Format) Ext() string {
+	if f == FormatJPEG {
+		return ".jpg"
+	}
+	return "." + string(f)
+}
+
+// DefaultWidths are the widths thumbnails are rendered at.
+var DefaultWidths = []int{320, 640, 1280}
+
+const (
+	jpegQuality = 85
+	// maxPixels guards against images that are small on the wire but
+	// enormous once decoded.
+	maxPixels = 50_000_000
+)
+
+var ErrInvalidImage = errors.New("invalid image")
+
+// Decode reads a JPEG, PNG or WebP image.
+func Decode(data []byte) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxPixels {
+		return nil, fmt.Errorf("%w: unsupported dimensions %dx%d", ErrInvalidImage, cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	return img, nil
+}
+
+type Variant struct {
+	Width  int
+	Height int
+	Format Format
+	Data   []byte
+}
+
+// Variants renders img at each of widths in every format. Widths larger
+// than the image are skipped rather than upscaled; if that leaves none, the
+// image is rendered at its own width.
+//
+// The WebP encoder only writes lossless images, so for photographic frames
+// the WebP variants are usually larger than the quality 85 JPEGs.
+func Variants(img image.Image, widths []int) ([]Variant, error) {
+	srcWidth := img.Bounds().Dx()
+	var fitting []int
+	for _, width := range widths {
+		if width <= srcWidth {
+			fitting = append(fitting, width)
+		}
+	}
+	if len(fitting) == 0 {
+		fitting = []int{srcWidth}
+	}
+
+	var variants []Variant
+	for _, width := range fitting {
+		resized := Resize(img, width)
+		for _, format := range []Format{FormatJPEG, FormatWebP} {
+			var buf bytes.Buffer
+			err := Encode(&buf, resized, format)
+			if err != nil {
+				return nil, err
+			}
+			variants = append(variants, Variant{
+				Width:  width,
+				Height: resized.Bounds().Dy(),
+				Format: format,
+				Data:   buf.Bytes(),
+			})
+		}
+	}
+	return variants, nil
+}
+
+// Resize scales img to width, keeping its aspect ratio.
+func Resize(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	height := max(1, int(int64(bounds.Dy())*int64(width)/int64(bounds.Dx())))
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+func Encode(w io.Writer, img image.Image, format Format) error {
+	switch format {
+	case FormatJPEG:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+	case FormatWebP:
+		return nativewebp.Encode(w, img, nil)
+	default:
+		return fmt.Errorf("unsupported image format %q", format)
+	}
+}
@@ -0,0 +1,32 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+// ProcessVideoForFastStart remuxes the MP4 at inputPath so its moov atom
+// comes first, letting players start before the whole file has downloaded.
+// The result is written next to the input and its path returned; the caller
+// is responsible for removing it.
+func ProcessVideoForFastStart(ctx context.Context, inputPath string) (string, error) {
+	outputPath := inputPath + ".processing"
+
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-y",
+		"-v", "error",
+		"-i", inputPath,
+		"-c", "copy",
+		"-movflags", "faststart",
+		"-f", "mp4",
+		outputPath,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("ffmpeg faststart failed: %w: %s", err, stderr.String())
+	}
+	return outputPath, nil
+}
@@ -0,0 +1,84 @@
+package media
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestProcessVideoForFastStart(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not installed")
+	}
+
+	// ffmpeg's mp4 muxer writes moov after mdat unless asked not to.
+	inputPath := filepath.Join(t.TempDir(), "clip.mp4")
+	out, err := exec.Command("ffmpeg",
+		"-y",
+		"-v", "error",
+		"-f", "lavfi",
+		"-i", "testsrc=duration=1:size=160x120:rate=10",
+		"-c:v", "mpeg4",
+		"-f", "mp4",
+		inputPath,
+	).CombinedOutput()
+	if err != nil {
+		t.Fatalf("couldn't generate clip: %v: %s", err, out)
+	}
+	if boxes := topLevelBoxes(t, inputPath); boxIndex(boxes, "moov") < boxIndex(boxes, "mdat") {
+		t.Fatalf("test clip already has moov first: %v", boxes)
+	}
+
+	outputPath, err := ProcessVideoForFastStart(context.Background(), inputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(outputPath)
+
+	boxes := topLevelBoxes(t, outputPath)
+	moov, mdat := boxIndex(boxes, "moov"), boxIndex(boxes, "mdat")
+	if moov < 0 || mdat < 0 {
+		t.Fatalf("missing moov or mdat: %v", boxes)
+	}
+	if moov > mdat {
+		t.Errorf("moov comes after mdat: %v", boxes)
+	}
+}
+
+// topLevelBoxes lists the types of the boxes at the top level of an MP4.
+func topLevelBoxes(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var boxes []string
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data[:4]))
+		boxes = append(boxes, string(data[4:8]))
+		switch size {
+		case 0:
+			// The box runs to the end of the file.
+			return boxes
+		case 1:
+			if len(data) < 16 {
+				t.Fatalf("truncated box header in %s", path)
+			}
+			size = binary.BigEndian.Uint64(data[8:16])
+		}
+		if size < 8 || size > uint64(len(data)) {
+			t.Fatalf("bad size %d for %q box in %s", size, boxes[len(boxes)-1], path)
+		}
+		data = data[size:]
+	}
+	return boxes
+}
+
+func boxIndex(boxes []string, typ string) int {
+	return slices.Index(boxes, typ)
+}
@@ -0,0 +1,129 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const HLSMasterPlaylist = "master.m3u8"
+
+type Rendition struct {
+	Name string
+	// Height is the size of the shorter side, so a 720p rendition of a
+	// portrait video is 720 pixels wide.
+	Height       int
+	VideoBitrate int // kbit/s
+	AudioBitrate int // kbit/s
+}
+
+var DefaultHLSLadder = []Rendition{
+	{Name: "1080p", Height: 1080, VideoBitrate: 5000, AudioBitrate: 192},
+	{Name: "720p", Height: 720, VideoBitrate: 2800, AudioBitrate: 128},
+	{Name: "480p", Height: 480, VideoBitrate: 1400, AudioBitrate: 128},
+	{Name: "360p", Height: 360, VideoBitrate: 800, AudioBitrate: 96},
+}
+
+// TranscodeHLS encodes inputPath into an HLS ladder under outputDir: one
+// directory per rendition holding its playlist and segments, plus
+// HLSMasterPlaylist at the top. Renditions larger than the source are
+// skipped, except that the smallest one is always produced.
+func TranscodeHLS(ctx context.Context, inputPath, outputDir string, ladder []Rendition) error {
+	out, err := probe(ctx, inputPath)
+	if err != nil {
+		return err
+	}
+	stream, err := out.videoStream()
+	if err != nil {
+		return err
+	}
+	width, height := stream.displaySize()
+	portrait := height > width
+
+	renditions := []Rendition{}
+	for _, r := range ladder {
+		if r.Height <= min(width, height) {
+			renditions = append(renditions, r)
+		}
+	}
+	if len(renditions) == 0 && len(ladder) > 0 {
+		renditions = ladder[len(ladder)-1:]
+	}
+	if len(renditions) == 0 {
+		return fmt.Errorf("no HLS renditions configured")
+	}
+
+	hasAudio := false
+	for _, s := range out.Streams {
+		if s.CodecType == "audio" {
+			hasAudio = true
+			break
+		}
+	}
+
+	var filter strings.Builder
+	fmt.Fprintf(&filter, "[0:v]split=%d", len(renditions))
+	for i := range renditions {
+		fmt.Fprintf(&filter, "[v%d]", i)
+	}
+	for i, r := range renditions {
+		scale := fmt.Sprintf("scale=-2:%d", r.Height)
+		if portrait {
+			scale = fmt.Sprintf("scale=%d:-2", r.Height)
+		}
+		fmt.Fprintf(&filter, ";[v%d]%s[v%dout]", i, scale, i)
+	}
+
+	args := []string{
+		"-y",
+		"-v", "error",
+		"-i", inputPath,
+		"-filter_complex", filter.String(),
+	}
+	streamMap := make([]string, 0, len(renditions))
+	for i, r := range renditions {
+		args = append(args,
+			"-map", fmt.Sprintf("[v%dout]", i),
+			fmt.Sprintf("-c:v:%d", i), "libx264",
+			fmt.Sprintf("-b:v:%d", i), fmt.Sprintf("%dk", r.VideoBitrate),
+			fmt.Sprintf("-maxrate:v:%d", i), fmt.Sprintf("%dk", r.VideoBitrate*107/100),
+			fmt.Sprintf("-bufsize:v:%d", i), fmt.Sprintf("%dk", r.VideoBitrate*3/2),
+		)
+		entry := fmt.Sprintf("v:%d", i)
+		if hasAudio {
+			args = append(args,
+				"-map", "0:a:0",
+				fmt.Sprintf("-c:a:%d", i), "aac",
+				fmt.Sprintf("-b:a:%d", i), fmt.Sprintf("%dk", r.AudioBitrate),
+				fmt.Sprintf("-ac:a:%d", i), "2",
+			)
+			entry += fmt.Sprintf(",a:%d", i)
+		}
+		streamMap = append(streamMap, entry+",name:"+r.Name)
+	}
+	args = append(args,
+		"-preset", "veryfast",
+		"-pix_fmt", "yuv420p",
+		// Keyframes on segment boundaries keep renditions switchable.
+		"-force_key_frames", "expr:gte(t,n_forced*6)",
+		"-f", "hls",
+		"-hls_time", "6",
+		"-hls_playlist_type", "vod",
+		"-hls_flags", "independent_segments",
+		"-hls_segment_filename", filepath.Join(outputDir, "%v", "segment_%03d.ts"),
+		"-master_pl_name", HLSMasterPlaylist,
+		"-var_stream_map", strings.Join(streamMap, " "),
+		filepath.Join(outputDir, "%v", "index.m3u8"),
+	)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg HLS transcode failed: %w: %s", err, stderr.String())
+	}
+	return nil
+}
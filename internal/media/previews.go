@@ -0,0 +1,106 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// PreviewsVTT is the name of the WebVTT file GeneratePreviews writes next to
+// its sprite sheets. Cues reference the sheets by relative URL, so the
+// directory must be served as a whole.
+const PreviewsVTT = "previews.vtt"
+
+type PreviewOptions struct {
+	// Interval is how often a frame is sampled.
+	Interval time.Duration
+	// Width is the width of each frame in the sprite sheet; the height
+	// follows the video's aspect ratio.
+	Width   int
+	Columns int
+	Rows    int
+}
+
+var DefaultPreviewOptions = PreviewOptions{
+	Interval: 5 * time.Second,
+	Width:    160,
+	Columns:  5,
+	Rows:     5,
+}
+
+// GeneratePreviews samples a frame from the video at inputPath every
+// opts.Interval, tiles the frames into JPEG sprite sheets in outputDir and
+// writes a PreviewsVTT file mapping each interval to its frame.
+func GeneratePreviews(ctx context.Context, inputPath, outputDir string, opts PreviewOptions) error {
+	out, err := probe(ctx, inputPath)
+	if err != nil {
+		return err
+	}
+	stream, err := out.videoStream()
+	if err != nil {
+		return err
+	}
+	duration, err := out.duration()
+	if err != nil {
+		return err
+	}
+	width, height := stream.displaySize()
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("invalid video dimensions %dx%d", width, height)
+	}
+	tileWidth := opts.Width
+	// Encoders want even dimensions.
+	tileHeight := max(2, (tileWidth*height/width)/2*2)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-y",
+		"-v", "error",
+		"-i", inputPath,
+		"-vf", fmt.Sprintf("fps=1/%g,scale=%d:%d,tile=%dx%d",
+			opts.Interval.Seconds(), tileWidth, tileHeight, opts.Columns, opts.Rows),
+		"-q:v", "4",
+		"-f", "image2",
+		filepath.Join(outputDir, "sprite_%03d.jpg"),
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg preview generation failed: %w: %s", err, stderr.String())
+	}
+
+	sheets, err := filepath.Glob(filepath.Join(outputDir, "sprite_*.jpg"))
+	if err != nil {
+		return err
+	}
+	if len(sheets) == 0 {
+		return fmt.Errorf("ffmpeg produced no sprite sheets for %s", inputPath)
+	}
+
+	perSheet := opts.Columns * opts.Rows
+	var vtt strings.Builder
+	vtt.WriteString("WEBVTT\n")
+	for i := 0; time.Duration(i)*opts.Interval < duration; i++ {
+		sheet := i / perSheet
+		if sheet >= len(sheets) {
+			break
+		}
+		start := time.Duration(i) * opts.Interval
+		end := min(start+opts.Interval, duration)
+		x := (i % perSheet % opts.Columns) * tileWidth
+		y := (i % perSheet / opts.Columns) * tileHeight
+		fmt.Fprintf(&vtt, "\n%s --> %s\nsprite_%03d.jpg#xywh=%d,%d,%d,%d\n",
+			vttTimestamp(start), vttTimestamp(end), sheet+1, x, y, tileWidth, tileHeight)
+	}
+
+	return os.WriteFile(filepath.Join(outputDir, PreviewsVTT), []byte(vtt.String()), 0644)
+}
+
+func vttTimestamp(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
@@ -0,0 +1,204 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	AspectRatioLandscape = "16:9"
+	AspectRatioPortrait  = "9:16"
+	AspectRatioOther     = "other"
+)
+
+// Info is what Probe reports about a media file.
+type Info struct {
+	// Duration is 0 if the container doesn't record a usable one, as with
+	// some streamed or damaged files.
+	Duration time.Duration
+	// Width and Height are the displayed dimensions, after rotation.
+	Width           int
+	Height          int
+	AspectRatio     string
+	VideoCodec      string
+	AudioCodec      string
+	Bitrate         int64
+	FrameRate       float64
+	AudioChannels   int
+	ContainerFormat string
+}
+
+type probeOutput struct {
+	Streams []probeStream `json:"streams"`
+	Format  struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"format"`
+}
+
+type probeStream struct {
+	CodecType    string `json:"codec_type"`
+	CodecName    string `json:"codec_name"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	AvgFrameRate string `json:"avg_frame_rate"`
+	Channels     int    `json:"channels"`
+	SideDataList []struct {
+		Rotation int `json:"rotation"`
+	} `json:"side_data_list"`
+	Tags struct {
+		Rotate string `json:"rotate"`
+	} `json:"tags"`
+}
+
+func probe(ctx context.Context, filePath string) (probeOutput, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-print_format", "json",
+		"-show_streams",
+		"-show_format",
+		filePath,
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return probeOutput{}, fmt.Errorf("ffprobe failed: %w: %s", err, stderr.String())
+	}
+
+	var out probeOutput
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return probeOutput{}, fmt.Errorf("couldn't parse ffprobe output: %w", err)
+	}
+	return out, nil
+}
+
+func (out probeOutput) videoStream() (probeStream, error) {
+	for _, s := range out.Streams {
+		if s.CodecType == "video" {
+			return s, nil
+		}
+	}
+	return probeStream{}, errors.New("no video stream found")
+}
+
+func (out probeOutput) audioStream() (probeStream, bool) {
+	for _, s := range out.Streams {
+		if s.CodecType == "audio" {
+			return s, true
+		}
+	}
+	return probeStream{}, false
+}
+
+func (out probeOutput) duration() (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(out.Format.Duration, 64)
+	if err != nil || seconds <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", out.Format.Duration)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// displaySize returns the dimensions the stream is shown at, taking rotation
+// metadata written by phones into account.
+func (s probeStream) displaySize() (int, int) {
+	rotation := 0
+	for _, sd := range s.SideDataList {
+		if sd.Rotation != 0 {
+			rotation = sd.Rotation
+		}
+	}
+	if rotation == 0 && s.Tags.Rotate != "" {
+		rotation, _ = strconv.Atoi(s.Tags.Rotate)
+	}
+	if rotation%180 != 0 {
+		return s.Height, s.Width
+	}
+	return s.Width, s.Height
+}
+
+// Probe describes the first video stream, the first audio stream if there
+// is one, and the container of filePath.
+func Probe(ctx context.Context, filePath string) (Info, error) {
+	out, err := probe(ctx, filePath)
+	if err != nil {
+		return Info{}, err
+	}
+	stream, err := out.videoStream()
+	if err != nil {
+		return Info{}, err
+	}
+	// The rest of the file is still usable without a duration.
+	duration, _ := out.duration()
+
+	width, height := stream.displaySize()
+	info := Info{
+		Duration:        duration,
+		Width:           width,
+		Height:          height,
+		AspectRatio:     classifyAspectRatio(width, height),
+		VideoCodec:      stream.CodecName,
+		FrameRate:       parseFrameRate(stream.AvgFrameRate),
+		ContainerFormat: out.Format.FormatName,
+	}
+	info.Bitrate, _ = strconv.ParseInt(out.Format.BitRate, 10, 64)
+	if audio, ok := out.audioStream(); ok {
+		info.AudioCodec = audio.CodecName
+		info.AudioChannels = audio.Channels
+	}
+	return info, nil
+}
+
+// parseFrameRate parses ffprobe's rational frame rates such as "30000/1001".
+// It returns 0 if the rate is unknown.
+func parseFrameRate(rate string) float64 {
+	num, den, ok := strings.Cut(rate, "/")
+	if !ok {
+		f, _ := strconv.ParseFloat(rate, 64)
+		return f
+	}
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || d == 0 {
+		return 0
+	}
+	return math.Round(n/d*1000) / 1000
+}
+
+func classifyAspectRatio(width, height int) string {
+	if width <= 0 || height <= 0 {
+		return AspectRatioOther
+	}
+	const tolerance = 0.02
+	ratio := float64(width) / float64(height)
+	switch {
+	case math.Abs(ratio-16.0/9.0) < tolerance:
+		return AspectRatioLandscape
+	case math.Abs(ratio-9.0/16.0) < tolerance:
+		return AspectRatioPortrait
+	default:
+		return AspectRatioOther
+	}
+}
+
+// OrientationPrefix maps an aspect ratio to the key prefix its objects are
+// stored under.
+func OrientationPrefix(aspectRatio string) string {
+	switch aspectRatio {
+	case AspectRatioLandscape:
+		return "landscape"
+	case AspectRatioPortrait:
+		return "portrait"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,88 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+type ThumbnailMode string
+
+const (
+	// ThumbnailModeTimestamp grabs the frame at ThumbnailOptions.At.
+	ThumbnailModeTimestamp ThumbnailMode = "timestamp"
+	// ThumbnailModeScene grabs the first scene change after
+	// ThumbnailOptions.At, which tends to skip black or fading intros.
+	ThumbnailModeScene ThumbnailMode = "scene"
+)
+
+// sceneChangeThreshold is how different (0-1) a frame must be from the one
+// before it to count as a scene change.
+const sceneChangeThreshold = 0.4
+
+type ThumbnailOptions struct {
+	Mode ThumbnailMode
+	At   time.Duration
+}
+
+// ExtractThumbnail writes a JPEG frame from the video at inputPath to
+// outputPath. If the chosen frame doesn't exist, because the video is
+// shorter than opts.At or has no scene change, it falls back to earlier
+// frames rather than failing.
+func ExtractThumbnail(ctx context.Context, inputPath, outputPath string, opts ThumbnailOptions) error {
+	attempts := []struct {
+		at    time.Duration
+		scene bool
+	}{
+		{opts.At, opts.Mode == ThumbnailModeScene},
+		{opts.At, false},
+		{0, false},
+	}
+
+	for _, attempt := range attempts {
+		err := extractFrame(ctx, inputPath, outputPath, attempt.at, attempt.scene)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(outputPath)
+		if err == nil && info.Size() > 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("ffmpeg produced no thumbnail for %s", inputPath)
+}
+
+func extractFrame(ctx context.Context, inputPath, outputPath string, at time.Duration, scene bool) error {
+	os.Remove(outputPath)
+
+	args := []string{
+		"-y",
+		"-v", "error",
+		"-ss", strconv.FormatFloat(at.Seconds(), 'f', 3, 64),
+		"-i", inputPath,
+	}
+	if scene {
+		args = append(args,
+			"-vf", fmt.Sprintf("select='gt(scene,%g)'", sceneChangeThreshold),
+			"-fps_mode", "vfr",
+		)
+	}
+	args = append(args,
+		"-frames:v", "1",
+		"-q:v", "2",
+		"-f", "image2",
+		outputPath,
+	)
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("ffmpeg thumbnail extraction failed: %w: %s", err, stderr.String())
+	}
+	return nil
+}
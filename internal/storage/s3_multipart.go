@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	minPartSize  = 5 << 20
+	maxPartCount = 10000
+)
+
+type uploadPart struct {
+	number int32
+	data   []byte
+}
+
+// putMultipart streams body to S3 as a multipart upload. Parts are read
+// sequentially and uploaded by a bounded pool of workers, each retrying its
+// part independently. If anything fails the upload is aborted so S3 doesn't
+// keep (and bill for) the parts that did make it.
+func (s *S3Store) putMultipart(ctx context.Context, key string, body io.Reader, size int64, contentType string) (err error) {
+	partSize := s.partSize(size)
+	first := make([]byte, partSize)
+	n, err := io.ReadFull(body, first)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		// The whole body fits in one part, so a single PutObject will do.
+		return s.putObject(ctx, key, bytes.NewReader(first[:n]), int64(n), contentType)
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't read upload body: %w", err)
+	}
+
+	created, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't create multipart upload: %w", err)
+	}
+	uploadID := created.UploadId
+
+	defer func() {
+		if err == nil {
+			return
+		}
+		// ctx may be what failed us, so abort on a context of our own.
+		abortCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_, abortErr := s.client.AbortMultipartUpload(abortCtx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(s.bucket),
+			Key:      aws.String(key),
+			UploadId: uploadID,
+		})
+		if abortErr != nil {
+			err = errors.Join(err, fmt.Errorf("couldn't abort multipart upload %s: %w", aws.ToString(uploadID), abortErr))
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu        sync.Mutex
+		completed []types.CompletedPart
+		partErr   error
+		wg        sync.WaitGroup
+	)
+	parts := make(chan uploadPart)
+	for range s.multipart.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for part := range parts {
+				etag, err := s.uploadPartWithRetry(ctx, key, uploadID, part)
+				mu.Lock()
+				if err != nil {
+					if partErr == nil {
+						partErr = err
+					}
+					cancel()
+				} else {
+					completed = append(completed, types.CompletedPart{
+						ETag:       etag,
+						PartNumber: aws.Int32(part.number),
+					})
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	readErr := s.readParts(ctx, first, body, parts)
+	close(parts)
+	wg.Wait()
+
+	if partErr != nil {
+		return partErr
+	}
+	if readErr != nil {
+		return readErr
+	}
+
+	slices.SortFunc(completed, func(a, b types.CompletedPart) int {
+		return int(aws.ToInt32(a.PartNumber) - aws.ToInt32(b.PartNumber))
+	})
+	_, err = s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucket),
+		Key:             aws.String(key),
+		UploadId:        uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't complete multipart upload: %w", err)
+	}
+	return nil
+}
+
+// readParts hands first and then the rest of body, in chunks of the same
+// size, to the upload workers.
+func (s *S3Store) readParts(ctx context.Context, first []byte, body io.Reader, parts chan<- uploadPart) error {
+	select {
+	case parts <- uploadPart{number: 1, data: first}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	for number := int32(2); ; number++ {
+		if number > maxPartCount {
+			return fmt.Errorf("upload needs more than %d parts", maxPartCount)
+		}
+		buf := make([]byte, len(first))
+		n, err := io.ReadFull(body, buf)
+		if n > 0 {
+			select {
+			case parts <- uploadPart{number: number, data: buf[:n]}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't read upload body: %w", err)
+		}
+	}
+}
+
+// partSize grows the configured part size when needed so that an upload of
+// the given size fits within S3's part count limit.
+func (s *S3Store) partSize(size int64) int64 {
+	partSize := max(s.multipart.PartSize, minPartSize)
+	if size > 0 && size/partSize >= maxPartCount {
+		partSize = size/(maxPartCount-1) + 1
+	}
+	return partSize
+}
+
+func (s *S3Store) uploadPartWithRetry(ctx context.Context, key string, uploadID *string, part uploadPart) (*string, error) {
+	backoff := 500 * time.Millisecond
+	var lastErr error
+	for attempt := 0; attempt <= s.multipart.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+				backoff *= 2
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		out, err := s.client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:        aws.String(s.bucket),
+			Key:           aws.String(key),
+			UploadId:      uploadID,
+			PartNumber:    aws.Int32(part.number),
+			Body:          bytes.NewReader(part.data),
+			ContentLength: aws.Int64(int64(len(part.data))),
+		})
+		if err == nil {
+			return out.ETag, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("couldn't upload part %d after %d attempts: %w", part.number, s.multipart.MaxRetries+1, lastErr)
+}
@@ -0,0 +1,243 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+)
+
+const testBucket = "test-bucket"
+
+// fakeS3 is an in-memory S3 server that records the requests it gets and
+// can be told to fail some of them.
+type fakeS3 struct {
+	handler http.Handler
+
+	mu       sync.Mutex
+	requests map[string]int
+	// fail, if set, is asked about every request and fails those it
+	// returns true for.
+	fail func(kind string, r *http.Request) bool
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	kind := requestKind(r)
+	f.mu.Lock()
+	f.requests[kind]++
+	fail := f.fail != nil && f.fail(kind, r)
+	f.mu.Unlock()
+	if fail {
+		io.Copy(io.Discard, r.Body)
+		http.Error(w, "injected failure", http.StatusInternalServerError)
+		return
+	}
+	f.handler.ServeHTTP(w, r)
+}
+
+func (f *fakeS3) count(kind string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[kind]
+}
+
+func requestKind(r *http.Request) string {
+	q := r.URL.Query()
+	switch {
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		return "create"
+	case r.Method == http.MethodPut && q.Has("partNumber"):
+		return "part"
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		return "complete"
+	case r.Method == http.MethodDelete && q.Has("uploadId"):
+		return "abort"
+	case r.Method == http.MethodPut:
+		return "put"
+	default:
+		return r.Method
+	}
+}
+
+func newTestS3Store(t *testing.T, multipart MultipartConfig) (*S3Store, *fakeS3) {
+	t.Helper()
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	// Leave retrying failed parts to the store, not the SDK.
+	t.Setenv("AWS_MAX_ATTEMPTS", "1")
+
+	backend := s3mem.New()
+	if err := backend.CreateBucket(testBucket); err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeS3{
+		handler:  gofakes3.New(backend).Server(),
+		requests: map[string]int{},
+	}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	store, err := NewS3Store(context.Background(), S3Config{
+		Bucket:    testBucket,
+		Region:    "us-east-1",
+		Endpoint:  srv.URL,
+		Multipart: multipart,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, fake
+}
+
+func testData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	return data
+}
+
+func assertStored(t *testing.T, store *S3Store, key string, want []byte) {
+	t.Helper()
+	body, info, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("couldn't get %s: %v", key, err)
+	}
+	defer body.Close()
+	got, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("stored %d bytes, want %d matching bytes", len(got), len(want))
+	}
+	if info.ContentType != "video/mp4" {
+		t.Errorf("content type = %q, want video/mp4", info.ContentType)
+	}
+}
+
+func TestS3PutMultipart(t *testing.T) {
+	data := testData(2*minPartSize + 1234)
+
+	tests := []struct {
+		name string
+		size int64
+	}{
+		{"known size", int64(len(data))},
+		{"unknown size", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, fake := newTestS3Store(t, MultipartConfig{
+				Threshold:   minPartSize,
+				PartSize:    minPartSize,
+				Concurrency: 2,
+			})
+
+			err := store.Put(context.Background(), "video.mp4", bytes.NewReader(data), tt.size, "video/mp4")
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertStored(t, store, "video.mp4", data)
+			if n := fake.count("create"); n != 1 {
+				t.Errorf("created %d multipart uploads, want 1", n)
+			}
+			if n := fake.count("part"); n != 3 {
+				t.Errorf("uploaded %d parts, want 3", n)
+			}
+			if n := fake.count("put"); n != 0 {
+				t.Errorf("made %d single-part uploads, want 0", n)
+			}
+		})
+	}
+}
+
+func TestS3PutMultipartSinglePartFallback(t *testing.T) {
+	store, fake := newTestS3Store(t, MultipartConfig{
+		Threshold: minPartSize,
+		PartSize:  minPartSize,
+	})
+	data := testData(1000)
+
+	// An unknown size always starts a multipart upload, but a body that
+	// fits in one part is sent as a plain PutObject.
+	err := store.Put(context.Background(), "small.mp4", bytes.NewReader(data), -1, "video/mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStored(t, store, "small.mp4", data)
+	if n := fake.count("put"); n != 1 {
+		t.Errorf("made %d single-part uploads, want 1", n)
+	}
+	if n := fake.count("create"); n != 0 {
+		t.Errorf("created %d multipart uploads, want 0", n)
+	}
+}
+
+type failingReader struct {
+	err error
+}
+
+func (r failingReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+func TestS3PutMultipartAbortsOnReadError(t *testing.T) {
+	store, fake := newTestS3Store(t, MultipartConfig{
+		Threshold: minPartSize,
+		PartSize:  minPartSize,
+	})
+	readErr := errors.New("connection reset")
+	body := io.MultiReader(bytes.NewReader(testData(minPartSize+100)), failingReader{readErr})
+
+	err := store.Put(context.Background(), "broken.mp4", body, -1, "video/mp4")
+	if !errors.Is(err, readErr) {
+		t.Fatalf("Put error = %v, want %v", err, readErr)
+	}
+	if n := fake.count("abort"); n != 1 {
+		t.Errorf("aborted %d multipart uploads, want 1", n)
+	}
+	if n := fake.count("complete"); n != 0 {
+		t.Errorf("completed %d multipart uploads, want 0", n)
+	}
+	_, err = store.Stat(context.Background(), "broken.mp4")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestS3PutMultipartRetriesFailedPart(t *testing.T) {
+	store, fake := newTestS3Store(t, MultipartConfig{
+		Threshold:  minPartSize,
+		PartSize:   minPartSize,
+		MaxRetries: 2,
+	})
+	failed := false
+	fake.fail = func(kind string, r *http.Request) bool {
+		if kind == "part" && r.URL.Query().Get("partNumber") == "2" && !failed {
+			failed = true
+			return true
+		}
+		return false
+	}
+	data := testData(2*minPartSize + 1234)
+
+	err := store.Put(context.Background(), "retried.mp4", bytes.NewReader(data), int64(len(data)), "video/mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertStored(t, store, "retried.mp4", data)
+	if n := fake.count("part"); n != 4 {
+		t.Errorf("made %d part uploads, want 4 (3 parts and 1 retry)", n)
+	}
+	if n := fake.count("abort"); n != 0 {
+		t.Errorf("aborted %d multipart uploads, want 0", n)
+	}
+}
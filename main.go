@@ -1,15 +1,19 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
-	"github.com/google/uuid"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
 
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
 )
 
 type apiConfig struct {
@@ -22,24 +26,31 @@ type apiConfig struct {
 	s3Region         string
 	s3CfDistribution string
 	port             string
+	store            storage.BlobStore
+	presignVideos    bool
+	presignExpiry    time.Duration
+	maxThumbnailSize int64
+	maxVideoSize     int64
+	uploadLocks      *sync.Map
+	uploadSessionTTL time.Duration
+	autoThumbnail    *media.ThumbnailOptions
+	previewOptions   media.PreviewOptions
 }
 
-type thumbnail struct {
-	data      []byte
-	mediaType string
-}
-
-var videoThumbnails = map[uuid.UUID]thumbnail{}
-
 func main() {
 	godotenv.Load(".env")
 
-	pathToDB := os.Getenv("DB_PATH")
-	if pathToDB == "" {
+	// DB_URL takes a postgres:// URL or a SQLite path; DB_PATH is the
+	// older name for the latter.
+	dbURL := os.Getenv("DB_URL")
+	if dbURL == "" {
+		dbURL = os.Getenv("DB_PATH")
+	}
+	if dbURL == "" {
 		log.Fatal("DB_URL must be set")
 	}
 
-	db, err := database.NewClient(pathToDB)
+	db, err := database.NewClient(dbURL)
 	if err != nil {
 		log.Fatalf("Couldn't connect to database: %v", err)
 	}
@@ -75,8 +86,35 @@ func main() {
 	}
 
 	s3CfDistribution := os.Getenv("S3_CF_DISTRO")
-	if s3CfDistribution == "" {
-		log.Fatal("S3_CF_DISTRO environment variable is not set")
+
+	s3Cfg := storage.S3Config{
+		Bucket:   s3Bucket,
+		Region:   s3Region,
+		Endpoint: os.Getenv("S3_ENDPOINT"),
+	}
+	if v := os.Getenv("S3_MULTIPART_THRESHOLD"); v != "" {
+		s3Cfg.Multipart.Threshold, err = parseByteSize(v)
+		if err != nil {
+			log.Fatalf("Invalid S3_MULTIPART_THRESHOLD: %v", err)
+		}
+	}
+	if v := os.Getenv("S3_MULTIPART_PART_SIZE"); v != "" {
+		s3Cfg.Multipart.PartSize, err = parseByteSize(v)
+		if err != nil {
+			log.Fatalf("Invalid S3_MULTIPART_PART_SIZE: %v", err)
+		}
+	}
+	if v := os.Getenv("S3_MULTIPART_CONCURRENCY"); v != "" {
+		s3Cfg.Multipart.Concurrency, err = strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("Invalid S3_MULTIPART_CONCURRENCY: %v", err)
+		}
+	}
+	if v := os.Getenv("S3_MULTIPART_MAX_RETRIES"); v != "" {
+		s3Cfg.Multipart.MaxRetries, err = strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("Invalid S3_MULTIPART_MAX_RETRIES: %v", err)
+		}
 	}
 
 	port := os.Getenv("PORT")
@@ -84,6 +122,87 @@ func main() {
 		log.Fatal("PORT environment variable is not set")
 	}
 
+	storageBackend := os.Getenv("STORAGE_BACKEND")
+	if storageBackend == "" {
+		storageBackend = "local"
+	}
+
+	presignVideos := false
+	if v := os.Getenv("PRESIGN_VIDEO_URLS"); v != "" {
+		presignVideos, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("Invalid PRESIGN_VIDEO_URLS: %v", err)
+		}
+	}
+
+	maxThumbnailSize := int64(10 << 20)
+	if v := os.Getenv("MAX_THUMBNAIL_SIZE"); v != "" {
+		maxThumbnailSize, err = parseByteSize(v)
+		if err != nil {
+			log.Fatalf("Invalid MAX_THUMBNAIL_SIZE: %v", err)
+		}
+	}
+
+	maxVideoSize := int64(1 << 30)
+	if v := os.Getenv("MAX_VIDEO_SIZE"); v != "" {
+		maxVideoSize, err = parseByteSize(v)
+		if err != nil {
+			log.Fatalf("Invalid MAX_VIDEO_SIZE: %v", err)
+		}
+	}
+
+	workerCount := 2
+	if v := os.Getenv("WORKER_COUNT"); v != "" {
+		workerCount, err = strconv.Atoi(v)
+		if err != nil {
+			log.Fatalf("Invalid WORKER_COUNT: %v", err)
+		}
+	}
+
+	presignExpiry := 15 * time.Minute
+	if v := os.Getenv("PRESIGN_EXPIRY"); v != "" {
+		presignExpiry, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Invalid PRESIGN_EXPIRY: %v", err)
+		}
+	}
+
+	uploadSessionTTL := 24 * time.Hour
+	if v := os.Getenv("UPLOAD_SESSION_TTL"); v != "" {
+		uploadSessionTTL, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Invalid UPLOAD_SESSION_TTL: %v", err)
+		}
+	}
+
+	autoThumbnail := &media.ThumbnailOptions{
+		Mode: media.ThumbnailModeScene,
+		At:   time.Second,
+	}
+	switch v := os.Getenv("AUTO_THUMBNAIL"); v {
+	case "", string(media.ThumbnailModeScene):
+	case string(media.ThumbnailModeTimestamp):
+		autoThumbnail.Mode = media.ThumbnailModeTimestamp
+	case "off":
+		autoThumbnail = nil
+	default:
+		log.Fatalf("Invalid AUTO_THUMBNAIL: %q (want scene, timestamp or off)", v)
+	}
+	if v := os.Getenv("AUTO_THUMBNAIL_AT"); v != "" && autoThumbnail != nil {
+		autoThumbnail.At, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Invalid AUTO_THUMBNAIL_AT: %v", err)
+		}
+	}
+
+	previewOptions := media.DefaultPreviewOptions
+	if v := os.Getenv("PREVIEW_INTERVAL"); v != "" {
+		previewOptions.Interval, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Invalid PREVIEW_INTERVAL: %v", err)
+		}
+	}
+
 	cfg := apiConfig{
 		db:               db,
 		jwtSecret:        jwtSecret,
@@ -94,6 +213,14 @@ func main() {
 		s3Region:         s3Region,
 		s3CfDistribution: s3CfDistribution,
 		port:             port,
+		presignVideos:    presignVideos,
+		presignExpiry:    presignExpiry,
+		maxThumbnailSize: maxThumbnailSize,
+		maxVideoSize:     maxVideoSize,
+		uploadLocks:      &sync.Map{},
+		uploadSessionTTL: uploadSessionTTL,
+		autoThumbnail:    autoThumbnail,
+		previewOptions:   previewOptions,
 	}
 
 	err = cfg.ensureAssetsDir()
@@ -101,12 +228,30 @@ func main() {
 		log.Fatalf("Couldn't create assets directory: %v", err)
 	}
 
+	cfg.store, err = newBlobStore(context.Background(), storageBackend, cfg, s3Cfg)
+	if err != nil {
+		log.Fatalf("Couldn't configure storage: %v", err)
+	}
+
+	if len(os.Args) > 1 {
+		err = cfg.runCommand(os.Args[1:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	err = cfg.migrate()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	mux := http.NewServeMux()
 	appHandler := http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))
 	mux.Handle("/app/", appHandler)
 
-	assetsHandler := http.StripPrefix("/assets", http.FileServer(http.Dir(assetsRoot)))
-	mux.Handle("/assets/", cacheMiddleware(assetsHandler))
+	assetsHandler := http.StripPrefix("/assets", cfg.protectPrivateAssets(http.FileServer(http.Dir(assetsRoot))))
+	mux.Handle("/assets/", cacheMiddleware(hideDotfiles(assetsHandler)))
 
 	mux.HandleFunc("POST /api/login", cfg.handlerLogin)
 	mux.HandleFunc("POST /api/refresh", cfg.handlerRefresh)
@@ -117,13 +262,26 @@ func main() {
 	mux.HandleFunc("POST /api/videos", cfg.handlerVideoMetaCreate)
 	mux.HandleFunc("POST /api/thumbnail_upload/{videoID}", cfg.handlerUploadThumbnail)
 	mux.HandleFunc("POST /api/video_upload/{videoID}", cfg.handlerUploadVideo)
+	mux.HandleFunc("POST /api/video_upload/{videoID}/sessions", cfg.handlerUploadSessionCreate)
+	mux.HandleFunc("HEAD /api/upload_sessions/{sessionID}", cfg.handlerUploadSessionStatus)
+	mux.HandleFunc("PATCH /api/upload_sessions/{sessionID}", cfg.handlerUploadSessionPatch)
+	mux.HandleFunc("POST /api/upload_sessions/{sessionID}/complete", cfg.handlerUploadSessionComplete)
+	mux.HandleFunc("GET /api/jobs/{jobID}", cfg.handlerJobGet)
 	mux.HandleFunc("GET /api/videos", cfg.handlerVideosRetrieve)
+	mux.HandleFunc("GET /api/videos/public", cfg.handlerVideosPublic)
+	mux.HandleFunc("GET /api/videos/search", cfg.handlerVideosSearch)
 	mux.HandleFunc("GET /api/videos/{videoID}", cfg.handlerVideoGet)
+	mux.HandleFunc("GET /api/videos/{videoID}/stream", cfg.handlerVideoStream)
+	mux.HandleFunc("GET /api/videos/{videoID}/assets/{expires}/{signature}/{key...}", cfg.handlerVideoAsset)
 	mux.HandleFunc("GET /api/thumbnails/{videoID}", cfg.handlerThumbnailGet)
+	mux.HandleFunc("PATCH /api/videos/{videoID}", cfg.handlerVideoMetaUpdate)
 	mux.HandleFunc("DELETE /api/videos/{videoID}", cfg.handlerVideoMetaDelete)
 
 	mux.HandleFunc("POST /admin/reset", cfg.handlerReset)
 
+	cfg.startWorkers(context.Background(), workerCount)
+	go cfg.runUploadSessionSweeper(context.Background())
+
 	srv := &http.Server{
 		Addr:    ":" + port,
 		Handler: mux,
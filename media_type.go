@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+)
+
+var (
+	allowedThumbnailTypes = []string{"image/jpeg", "image/png", "image/webp"}
+	allowedVideoTypes     = []string{"video/mp4"}
+)
+
+var errUnsupportedMediaType = errors.New("unsupported media type")
+
+// detectUploadMediaType checks the declared Content-Type of an uploaded file
+// against allowed and makes sure the file's leading bytes agree with it. The
+// file is rewound before returning.
+func detectUploadMediaType(file io.ReadSeeker, contentType string, allowed []string) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid Content-Type: %v", errUnsupportedMediaType, err)
+	}
+	if !slices.Contains(allowed, mediaType) {
+		return "", fmt.Errorf("%w: %s", errUnsupportedMediaType, mediaType)
+	}
+
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	sniffed, _, err := mime.ParseMediaType(http.DetectContentType(buf[:n]))
+	if err != nil {
+		return "", err
+	}
+	if sniffed != mediaType {
+		return "", fmt.Errorf("%w: declared %s but content looks like %s", errUnsupportedMediaType, mediaType, sniffed)
+	}
+
+	return mediaType, nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+func newBlobStore(ctx context.Context, backend string, cfg apiConfig, s3Cfg storage.S3Config) (storage.BlobStore, error) {
+	switch backend {
+	case "local":
+		return storage.NewLocalStore(cfg.assetsRoot, fmt.Sprintf("http://localhost:%s/assets", cfg.port))
+	case "s3":
+		return storage.NewS3Store(ctx, s3Cfg)
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q (expected \"local\" or \"s3\")", backend)
+	}
+}
+
+// objectURL returns the URL clients should use to fetch key, going through
+// the CDN when a distribution is configured.
+func (cfg *apiConfig) objectURL(key string) string {
+	if cfg.s3CfDistribution != "" {
+		return cfg.cdnBaseURL() + "/" + key
+	}
+	return cfg.store.URL(key)
+}
+
+func (cfg *apiConfig) cdnBaseURL() string {
+	distro := strings.TrimPrefix(cfg.s3CfDistribution, "https://")
+	return "https://" + strings.TrimSuffix(distro, "/")
+}
+
+// objectKey is the inverse of objectURL. It also accepts store URLs and
+// "bucket,key" pairs so values saved under an older configuration resolve.
+func (cfg *apiConfig) objectKey(objectURL string) (string, bool) {
+	if bucket, key, ok := parseBucketKey(objectURL); ok {
+		return key, bucket == cfg.s3Bucket
+	}
+	prefixes := []string{cfg.store.URL("")}
+	if cfg.s3CfDistribution != "" {
+		prefixes = append(prefixes, cfg.cdnBaseURL()+"/")
+	}
+	for _, prefix := range prefixes {
+		key, ok := strings.CutPrefix(objectURL, prefix)
+		if ok && key != "" {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// videoURLForStorage returns what is saved in a video's video_url column for
+// key: the public URL, or a "bucket,key" pair that is presigned on every read
+// when the bucket is private.
+func (cfg *apiConfig) videoURLForStorage(key string) string {
+	if cfg.presignVideos {
+		return cfg.s3Bucket + "," + key
+	}
+	return cfg.objectURL(key)
+}
+
+func parseBucketKey(value string) (string, string, bool) {
+	if strings.Contains(value, "://") {
+		return "", "", false
+	}
+	bucket, key, ok := strings.Cut(value, ",")
+	if !ok || bucket == "" || key == "" {
+		return "", "", false
+	}
+	return bucket, key, true
+}
+
+// dbVideoToSignedVideo replaces the stored URLs with ones the client can
+// use. In a private bucket the video URL is presigned, and private videos
+// whose file is publicly addressable get a signed stream endpoint URL
+// instead. Either way, the other files are served through signed asset
+// URLs, so a private video's stored URLs are never handed out.
+func (cfg *apiConfig) dbVideoToSignedVideo(ctx context.Context, video database.Video) (database.Video, error) {
+	if cfg.presignVideos || video.Visibility == database.VideoVisibilityPrivate {
+		video = cfg.withSignedAssetURLs(video)
+	}
+	if video.VideoURL == nil {
+		return video, nil
+	}
+	bucket, key, ok := parseBucketKey(*video.VideoURL)
+	if !ok {
+		if video.Visibility == database.VideoVisibilityPrivate {
+			streamURL := cfg.signedStreamURL(video.ID)
+			video.VideoURL = &streamURL
+		}
+		return video, nil
+	}
+	if bucket != cfg.s3Bucket {
+		return database.Video{}, fmt.Errorf("video %s is stored in unknown bucket %q", video.ID, bucket)
+	}
+	presignedURL, err := cfg.store.PresignGet(ctx, key, cfg.presignExpiry)
+	if err != nil {
+		return database.Video{}, err
+	}
+	video.VideoURL = &presignedURL
+	return video, nil
+}
+
+// withSignedAssetURLs points the video's thumbnails, HLS playlist and
+// previews at signed asset URLs. A presigned URL wouldn't do for the
+// playlist and previews, since the files they refer to by relative URL
+// would be left unsigned.
+func (cfg *apiConfig) withSignedAssetURLs(video database.Video) database.Video {
+	sign := func(u *string) *string {
+		if u == nil {
+			return nil
+		}
+		key, ok := cfg.objectKey(*u)
+		if !ok {
+			return u
+		}
+		signed := cfg.signedAssetURL(video.ID, key)
+		return &signed
+	}
+
+	video.ThumbnailURL = sign(video.ThumbnailURL)
+	video.HLSURL = sign(video.HLSURL)
+	video.PreviewsURL = sign(video.PreviewsURL)
+	if video.Thumbnails != nil {
+		thumbnails := database.Thumbnails{
+			JPEG: slices.Clone(video.Thumbnails.JPEG),
+			WebP: slices.Clone(video.Thumbnails.WebP),
+		}
+		for _, variants := range [][]database.ThumbnailVariant{thumbnails.JPEG, thumbnails.WebP} {
+			for i := range variants {
+				variants[i].URL = *sign(&variants[i].URL)
+			}
+		}
+		video.Thumbnails = &thumbnails
+	}
+	return video
+}
+
+// Registered with the mime package so both the stores and the /assets/
+// file server label streaming assets correctly.
+var assetContentTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".ts":   "video/mp2t",
+	".mp4":  "video/mp4",
+	".vtt":  "text/vtt",
+}
+
+func init() {
+	for ext, contentType := range assetContentTypes {
+		mime.AddExtensionType(ext, contentType)
+	}
+}
+
+func contentTypeForKey(key string) string {
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// assetPrefix is the key prefix derived assets of the object at key (HLS
+// renditions, resized variants, ...) are stored under.
+func assetPrefix(key string) string {
+	return strings.TrimSuffix(key, path.Ext(key)) + "/"
+}
+
+// putDir uploads every file below dir to the store, keyed by its path
+// relative to dir under prefix.
+func (cfg *apiConfig) putDir(ctx context.Context, dir, prefix string) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		key := prefix + filepath.ToSlash(rel)
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		err = cfg.store.Put(ctx, key, f, info.Size(), contentTypeForKey(key))
+		if err != nil {
+			return fmt.Errorf("couldn't store %s: %w", key, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/imaging"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+)
+
+// saveThumbnail stores a thumbnail image along with its resized variants
+// and returns what to record on the video. Uploaded and generated
+// thumbnails both go through here. Images that can't be decoded are
+// rejected with an error wrapping imaging.ErrInvalidImage.
+func (cfg *apiConfig) saveThumbnail(ctx context.Context, data []byte, mediaType string) (string, *database.Thumbnails, error) {
+	img, err := imaging.Decode(data)
+	if err != nil {
+		return "", nil, err
+	}
+	variants, err := imaging.Variants(img, imaging.DefaultWidths)
+	if err != nil {
+		return "", nil, err
+	}
+
+	key, err := getAssetPath(mediaType)
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = cfg.store.Put(ctx, key, bytes.NewReader(data), int64(len(data)), mediaType)
+	if err != nil {
+		return "", nil, err
+	}
+
+	thumbnails := &database.Thumbnails{}
+	for _, variant := range variants {
+		variantKey := fmt.Sprintf("%s%d%s", assetPrefix(key), variant.Width, variant.Format.Ext())
+		err = cfg.store.Put(ctx, variantKey, bytes.NewReader(variant.Data), int64(len(variant.Data)), variant.Format.MediaType())
+		if err != nil {
+			return "", nil, err
+		}
+
+		entry := database.ThumbnailVariant{
+			Width:  variant.Width,
+			Height: variant.Height,
+			URL:    cfg.objectURL(variantKey),
+		}
+		switch variant.Format {
+		case imaging.FormatJPEG:
+			thumbnails.JPEG = append(thumbnails.JPEG, entry)
+		case imaging.FormatWebP:
+			thumbnails.WebP = append(thumbnails.WebP, entry)
+		}
+	}
+
+	return cfg.objectURL(key), thumbnails, nil
+}
+
+// generateThumbnail gives a video without a thumbnail one taken from the
+// video file at srcPath. A thumbnail the user uploads in the meantime wins.
+func (cfg *apiConfig) generateThumbnail(ctx context.Context, video database.Video, srcPath string) error {
+	if cfg.autoThumbnail == nil || video.ThumbnailURL != nil {
+		return nil
+	}
+
+	dir, err := os.MkdirTemp("", "tubely-thumbnail-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	thumbnailPath := filepath.Join(dir, "thumbnail.jpg")
+	err = media.ExtractThumbnail(ctx, srcPath, thumbnailPath, *cfg.autoThumbnail)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(thumbnailPath)
+	if err != nil {
+		return err
+	}
+
+	thumbnailURL, thumbnails, err := cfg.saveThumbnail(ctx, data, "image/jpeg")
+	if err != nil {
+		return fmt.Errorf("couldn't store thumbnail: %w", err)
+	}
+
+	set, err := cfg.db.SetVideoThumbnailIfUnset(video.ID, thumbnailURL, thumbnails)
+	if err != nil {
+		return err
+	}
+	if !set {
+		if key, ok := cfg.objectKey(thumbnailURL); ok {
+			var unused storedObjects
+			unused.add(key)
+			if err := cfg.deleteObjects(ctx, unused); err != nil {
+				log.Printf("Couldn't delete unused thumbnail %s: %v", key, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// multipartMaxMemory bounds how much of a multipart body is kept in RAM;
+// file parts beyond it are spilled to temporary files.
+const multipartMaxMemory = 8 << 20
+
+// multipartOverhead leaves room for boundaries and part headers on top of
+// the file itself when capping the request body.
+const multipartOverhead = 1 << 20
+
+func parseUploadForm(w http.ResponseWriter, r *http.Request, maxSize int64) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+multipartOverhead)
+	return r.ParseMultipartForm(multipartMaxMemory)
+}
+
+func isUploadTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr) || errors.Is(err, multipart.ErrMessageTooLarge)
+}
+
+var byteSizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// parseByteSize accepts a plain number of bytes or a number followed by
+// KB, MB or GB (binary multiples).
+func parseByteSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range byteSizeUnits {
+		if n, ok := strings.CutSuffix(s, unit.suffix); ok {
+			s = strings.TrimSpace(n)
+			multiplier = unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("size must be positive, got %d", n)
+	}
+	return n * multiplier, nil
+}
+
+func formatByteSize(n int64) string {
+	for _, unit := range byteSizeUnits {
+		if n >= unit.size && n%unit.size == 0 {
+			return fmt.Sprintf("%d%s", n/unit.size, unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%dB", n)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultVideoPageSize = 20
+	maxVideoPageSize     = 100
+)
+
+// videoCursor is the decoded form of a next_cursor token: where the previous
+// page ended, and the ordering it was read in.
+type videoCursor struct {
+	Sort       database.VideoSort `json:"s"`
+	Descending bool               `json:"d"`
+	Value      string             `json:"v"`
+	ID         uuid.UUID          `json:"id"`
+}
+
+func encodeVideoCursor(sort database.VideoSort, descending bool, video database.Video) string {
+	cursor := videoCursor{Sort: sort, Descending: descending, ID: video.ID}
+	switch sort {
+	case database.VideoSortUpdatedAt:
+		cursor.Value = video.UpdatedAt.Format(time.RFC3339Nano)
+	case database.VideoSortTitle:
+		cursor.Value = video.Title
+	default:
+		cursor.Value = video.CreatedAt.Format(time.RFC3339Nano)
+	}
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeVideoCursor turns a cursor back into the video it points after. It
+// fails if the cursor is malformed or was issued for a different ordering.
+func decodeVideoCursor(token string, sort database.VideoSort, descending bool) (*database.Video, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+	var cursor videoCursor
+	err = json.Unmarshal(data, &cursor)
+	if err != nil {
+		return nil, err
+	}
+	if cursor.Sort != sort || cursor.Descending != descending {
+		return nil, errors.New("cursor was issued for a different sort order")
+	}
+
+	video := &database.Video{ID: cursor.ID}
+	switch sort {
+	case database.VideoSortUpdatedAt:
+		video.UpdatedAt, err = time.Parse(time.RFC3339Nano, cursor.Value)
+	case database.VideoSortTitle:
+		video.Title = cursor.Value
+	default:
+		video.CreatedAt, err = time.Parse(time.RFC3339Nano, cursor.Value)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return video, nil
+}
+
+// parseListVideosParams reads the listing options from a GET /api/videos
+// query string. The returned message is "" if they are valid.
+func parseListVideosParams(query url.Values) (database.ListVideosParams, string) {
+	params := database.ListVideosParams{
+		Status: database.VideoStatus(query.Get("status")),
+		Search: query.Get("q"),
+		Sort:   database.VideoSortCreatedAt,
+		Limit:  defaultVideoPageSize,
+	}
+	if params.Status != "" && !params.Status.Valid() {
+		return params, "Invalid status"
+	}
+
+	if sort := query.Get("sort"); sort != "" {
+		params.Sort = database.VideoSort(sort)
+		if !params.Sort.Valid() {
+			return params, "sort must be created_at, updated_at or title"
+		}
+	}
+	// Newest first for timestamps, A to Z for titles.
+	params.Descending = params.Sort != database.VideoSortTitle
+	switch query.Get("order") {
+	case "":
+	case "asc":
+		params.Descending = false
+	case "desc":
+		params.Descending = true
+	default:
+		return params, "order must be asc or desc"
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxVideoPageSize {
+			return params, "limit must be between 1 and " + strconv.Itoa(maxVideoPageSize)
+		}
+		params.Limit = n
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		after, err := decodeVideoCursor(cursor, params.Sort, params.Descending)
+		if err != nil {
+			return params, "Invalid cursor"
+		}
+		params.After = after
+	}
+	return params, ""
+}
+
+// highlightSnippet turns a search snippet into HTML, with matched terms in
+// <mark> elements and everything else escaped.
+func highlightSnippet(snippet string) string {
+	return strings.NewReplacer(
+		database.HighlightStart, "<mark>",
+		database.HighlightEnd, "</mark>",
+	).Replace(html.EscapeString(snippet))
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	maxVideoTitleLength       = 200
+	maxVideoDescriptionLength = 5000
+)
+
+// validateVideoTitle returns a message describing what is wrong with title,
+// or "" if it is acceptable.
+func validateVideoTitle(title string) string {
+	if strings.TrimSpace(title) == "" {
+		return "Title can't be empty"
+	}
+	if utf8.RuneCountInString(title) > maxVideoTitleLength {
+		return fmt.Sprintf("Title must be at most %d characters", maxVideoTitleLength)
+	}
+	return ""
+}
+
+func validateVideoDescription(description string) string {
+	if utf8.RuneCountInString(description) > maxVideoDescriptionLength {
+		return fmt.Sprintf("Description must be at most %d characters", maxVideoDescriptionLength)
+	}
+	return ""
+}
+
+// videoETag identifies a version of a video's metadata. Every write bumps
+// updated_at, so it changes whenever the video does.
+func videoETag(video database.Video) string {
+	return fmt.Sprintf(`"%x"`, video.UpdatedAt.UnixNano())
+}
+
+// ifMatch reports whether the request's If-Match header, if any, matches
+// etag. Weak validators never match, as RFC 9110 requires for If-Match.
+func ifMatch(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+	"github.com/google/uuid"
+)
+
+const jobKindProcessVideo = "process_video"
+
+type processVideoPayload struct {
+	VideoID   uuid.UUID `json:"video_id"`
+	Path      string    `json:"path"`
+	MediaType string    `json:"media_type"`
+}
+
+// enqueueVideoProcessing marks the video as processing and queues the staged
+// upload at stagingPath. The job takes ownership of the file and removes it
+// when done. If the video can't move to processing, the returned error wraps
+// database.ErrInvalidVideoStatusTransition.
+func (cfg *apiConfig) enqueueVideoProcessing(video database.Video, stagingPath, mediaType string) (database.Job, error) {
+	payload, err := json.Marshal(processVideoPayload{
+		VideoID:   video.ID,
+		Path:      stagingPath,
+		MediaType: mediaType,
+	})
+	if err != nil {
+		return database.Job{}, err
+	}
+
+	err = cfg.db.SetVideoStatus(video.ID, database.VideoStatusProcessing, "")
+	if err != nil {
+		return database.Job{}, err
+	}
+
+	job, err := cfg.db.EnqueueJob(database.EnqueueJobParams{
+		Kind:    jobKindProcessVideo,
+		Payload: string(payload),
+		UserID:  &video.UserID,
+	})
+	if err != nil {
+		if statusErr := cfg.db.SetVideoStatus(video.ID, database.VideoStatusFailed, "Couldn't queue video for processing"); statusErr != nil {
+			log.Printf("Couldn't mark video %s as failed: %v", video.ID, statusErr)
+		}
+		return database.Job{}, err
+	}
+	return job, nil
+}
+
+func (cfg *apiConfig) runProcessVideoJob(ctx context.Context, job database.Job) error {
+	var payload processVideoPayload
+	err := json.Unmarshal([]byte(job.Payload), &payload)
+	if err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+
+	video, err := cfg.db.GetVideo(payload.VideoID)
+	if err != nil {
+		return err
+	}
+	if video.ID == uuid.Nil {
+		// The video was deleted while queued; nothing left to do.
+		os.Remove(payload.Path)
+		return nil
+	}
+
+	_, err = cfg.processVideoUpload(ctx, video, payload.Path, payload.MediaType)
+	if err != nil {
+		return err
+	}
+	err = cfg.db.SetVideoStatus(video.ID, database.VideoStatusReady, "")
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("couldn't mark video ready: %w", err)
+	}
+	os.Remove(payload.Path)
+	return nil
+}
+
+func (cfg *apiConfig) giveUpProcessVideoJob(ctx context.Context, job database.Job) {
+	var payload processVideoPayload
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return
+	}
+	os.Remove(payload.Path)
+
+	message := "Processing failed"
+	if job.LastError != nil {
+		message = *job.LastError
+	}
+	err := cfg.db.SetVideoStatus(payload.VideoID, database.VideoStatusFailed, message)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Couldn't mark video %s as failed: %v", payload.VideoID, err)
+	}
+}
+
+// processVideoUpload runs the uploaded file at srcPath through the media
+// pipeline, stores the result and records its URL on video. srcPath is left
+// in place for the caller to clean up, but anything stored is removed again
+// if processing fails.
+func (cfg *apiConfig) processVideoUpload(ctx context.Context, video database.Video, srcPath, mediaType string) (_ database.Video, err error) {
+	info, err := media.Probe(ctx, srcPath)
+	if err != nil {
+		return database.Video{}, fmt.Errorf("couldn't probe video: %w", err)
+	}
+	aspectRatio := info.AspectRatio
+
+	assetPath, err := getAssetPath(mediaType)
+	if err != nil {
+		return database.Video{}, err
+	}
+	key := path.Join(media.OrientationPrefix(aspectRatio), assetPath)
+
+	processedPath, err := media.ProcessVideoForFastStart(ctx, srcPath)
+	if err != nil {
+		return database.Video{}, err
+	}
+	defer os.Remove(processedPath)
+
+	processedFile, err := os.Open(processedPath)
+	if err != nil {
+		return database.Video{}, err
+	}
+	defer processedFile.Close()
+
+	processedInfo, err := processedFile.Stat()
+	if err != nil {
+		return database.Video{}, err
+	}
+
+	err = cfg.store.Put(ctx, key, processedFile, processedInfo.Size(), mediaType)
+	if err != nil {
+		return database.Video{}, fmt.Errorf("couldn't store video: %w", err)
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		// A retry stores everything under a new key, so nothing would
+		// ever refer to these. ctx may be what failed us.
+		var stored storedObjects
+		stored.add(key)
+		if cleanupErr := cfg.deleteObjects(context.WithoutCancel(ctx), stored); cleanupErr != nil {
+			log.Printf("Couldn't clean up after failed processing of video %s: %v", video.ID, cleanupErr)
+		}
+	}()
+
+	hlsURL, err := cfg.transcodeHLS(ctx, processedPath, assetPrefix(key)+"hls/")
+	if err != nil {
+		return database.Video{}, err
+	}
+
+	// Like thumbnails, previews are a nicety the video works without.
+	previewsURL, err := cfg.generatePreviews(ctx, processedPath, assetPrefix(key)+"previews/")
+	if err != nil {
+		log.Printf("Couldn't generate previews for video %s: %v", video.ID, err)
+	}
+
+	// Processing takes a while; pick up anything changed on the video since,
+	// such as a thumbnail uploaded in the meantime.
+	video, err = cfg.db.GetVideo(video.ID)
+	if err != nil {
+		return database.Video{}, err
+	}
+	if video.ID == uuid.Nil {
+		// Deleted while processing; don't leave what was just stored behind.
+		var stored storedObjects
+		stored.add(key)
+		return database.Video{}, cfg.deleteObjects(ctx, stored)
+	}
+	videoURL := cfg.videoURLForStorage(key)
+	video.VideoURL = &videoURL
+	video.HLSURL = &hlsURL
+	video.PreviewsURL = previewsURL
+	video.AspectRatio = &aspectRatio
+	video.MediaInfo = &database.MediaInfo{
+		Width:           info.Width,
+		Height:          info.Height,
+		VideoCodec:      info.VideoCodec,
+		AudioCodec:      info.AudioCodec,
+		Bitrate:         info.Bitrate,
+		FrameRate:       info.FrameRate,
+		AudioChannels:   info.AudioChannels,
+		ContainerFormat: info.ContainerFormat,
+	}
+	if info.Duration > 0 {
+		seconds := info.Duration.Seconds()
+		video.MediaInfo.DurationSeconds = &seconds
+	}
+	err = cfg.db.UpdateVideo(video)
+	if err != nil {
+		return database.Video{}, fmt.Errorf("couldn't update video: %w", err)
+	}
+
+	// A missing thumbnail isn't worth failing (and retrying) the upload over.
+	err = cfg.generateThumbnail(ctx, video, processedPath)
+	if err != nil {
+		log.Printf("Couldn't generate thumbnail for video %s: %v", video.ID, err)
+	}
+
+	return video, nil
+}
+
+// transcodeHLS builds the HLS ladder for the video at srcPath, stores it
+// under prefix and returns the URL of the master playlist.
+func (cfg *apiConfig) transcodeHLS(ctx context.Context, srcPath, prefix string) (string, error) {
+	outputDir, err := os.MkdirTemp("", "tubely-hls-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(outputDir)
+
+	err = media.TranscodeHLS(ctx, srcPath, outputDir, media.DefaultHLSLadder)
+	if err != nil {
+		return "", err
+	}
+
+	err = cfg.putDir(ctx, outputDir, prefix)
+	if err != nil {
+		return "", err
+	}
+
+	return cfg.objectURL(prefix + media.HLSMasterPlaylist), nil
+}
+
+// generatePreviews builds seek-bar preview sprites for the video at srcPath,
+// stores them under prefix and returns the URL of their WebVTT index. It
+// returns nil if previews are disabled.
+func (cfg *apiConfig) generatePreviews(ctx context.Context, srcPath, prefix string) (*string, error) {
+	if cfg.previewOptions.Interval <= 0 {
+		return nil, nil
+	}
+
+	outputDir, err := os.MkdirTemp("", "tubely-previews-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(outputDir)
+
+	err = media.GeneratePreviews(ctx, srcPath, outputDir, cfg.previewOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	err = cfg.putDir(ctx, outputDir, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	previewsURL := cfg.objectURL(prefix + media.PreviewsVTT)
+	return &previewsURL, nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	jobLeaseDuration  = 2 * time.Minute
+	jobPollInterval   = 2 * time.Second
+	jobRetryBaseDelay = 30 * time.Second
+	jobRetryMaxDelay  = 30 * time.Minute
+)
+
+type jobHandler struct {
+	run func(ctx context.Context, job database.Job) error
+	// giveUp, if set, runs once a job has failed its last attempt.
+	giveUp func(ctx context.Context, job database.Job)
+}
+
+func (cfg *apiConfig) jobHandlers() map[string]jobHandler {
+	return map[string]jobHandler{
+		jobKindProcessVideo: {
+			run:    cfg.runProcessVideoJob,
+			giveUp: cfg.giveUpProcessVideoJob,
+		},
+		jobKindDeleteObjects: {
+			run:    cfg.runDeleteObjectsJob,
+			giveUp: cfg.giveUpDeleteObjectsJob,
+		},
+	}
+}
+
+func (cfg *apiConfig) startWorkers(ctx context.Context, n int) {
+	hostname, _ := os.Hostname()
+	for i := range n {
+		workerID := fmt.Sprintf("%s-%d-%d", hostname, os.Getpid(), i)
+		go cfg.runWorker(ctx, workerID)
+	}
+}
+
+func (cfg *apiConfig) runWorker(ctx context.Context, workerID string) {
+	handlers := cfg.jobHandlers()
+	for {
+		cfg.expireJobLeases(ctx, handlers)
+		job, err := cfg.db.LeaseJob(workerID, jobLeaseDuration)
+		if err != nil {
+			log.Printf("Worker %s couldn't lease a job: %v", workerID, err)
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(jobPollInterval):
+			}
+			continue
+		}
+		cfg.runJob(ctx, workerID, *job, handlers)
+	}
+}
+
+func (cfg *apiConfig) runJob(ctx context.Context, workerID string, job database.Job, handlers map[string]jobHandler) {
+	handler, ok := handlers[job.Kind]
+	var err error
+	if ok {
+		err = cfg.runWithHeartbeat(ctx, workerID, job, handler.run)
+	} else {
+		err = fmt.Errorf("unknown job kind %q", job.Kind)
+	}
+
+	if errors.Is(err, database.ErrJobLeaseLost) {
+		log.Printf("Job %s lost its lease and will be retried elsewhere", job.ID)
+		return
+	}
+	if err == nil {
+		err = cfg.db.CompleteJob(job.ID, workerID)
+		if err != nil {
+			log.Printf("Couldn't complete job %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	log.Printf("Job %s (%s) attempt %d/%d failed: %v", job.ID, job.Kind, job.Attempts, job.MaxAttempts, err)
+	failed, err := cfg.db.FailJob(job.ID, workerID, err, jobRetryDelay(job.Attempts))
+	if err != nil {
+		log.Printf("Couldn't record failure of job %s: %v", job.ID, err)
+		return
+	}
+	cfg.giveUpIfFailed(ctx, failed, handlers)
+}
+
+// expireJobLeases fails the attempts of jobs whose worker stopped renewing
+// their lease, say because it crashed, so a job that keeps crashing its
+// worker still runs out of attempts.
+func (cfg *apiConfig) expireJobLeases(ctx context.Context, handlers map[string]jobHandler) {
+	jobs, err := cfg.db.GetExpiredJobLeases()
+	if err != nil {
+		log.Printf("Couldn't get jobs with expired leases: %v", err)
+		return
+	}
+	for _, job := range jobs {
+		expired, err := cfg.db.ExpireJobLease(job, jobRetryDelay(job.Attempts))
+		if errors.Is(err, database.ErrJobLeaseLost) {
+			// Renewed, or another worker got there first.
+			continue
+		}
+		if err != nil {
+			log.Printf("Couldn't expire lease of job %s: %v", job.ID, err)
+			continue
+		}
+		log.Printf("Job %s (%s) attempt %d/%d lost its worker", job.ID, job.Kind, job.Attempts, job.MaxAttempts)
+		cfg.giveUpIfFailed(ctx, expired, handlers)
+	}
+}
+
+func (cfg *apiConfig) giveUpIfFailed(ctx context.Context, job database.Job, handlers map[string]jobHandler) {
+	handler, ok := handlers[job.Kind]
+	if job.Status == database.JobStatusFailed && ok && handler.giveUp != nil {
+		handler.giveUp(ctx, job)
+	}
+}
+
+// runWithHeartbeat runs fn while keeping the job's lease alive. If the lease
+// is lost, fn's context is cancelled and ErrJobLeaseLost returned.
+func (cfg *apiConfig) runWithHeartbeat(ctx context.Context, workerID string, job database.Job, fn func(context.Context, database.Job) error) error {
+	jobCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	go func() {
+		ticker := time.NewTicker(jobLeaseDuration / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-jobCtx.Done():
+				return
+			case <-ticker.C:
+				err := cfg.db.HeartbeatJob(job.ID, workerID, jobLeaseDuration)
+				if errors.Is(err, database.ErrJobLeaseLost) {
+					cancel(err)
+					return
+				}
+				if err != nil {
+					log.Printf("Couldn't extend lease of job %s: %v", job.ID, err)
+				}
+			}
+		}
+	}()
+
+	err := fn(jobCtx, job)
+	if cause := context.Cause(jobCtx); errors.Is(cause, database.ErrJobLeaseLost) {
+		return cause
+	}
+	return err
+}
+
+func jobRetryDelay(attempts int) time.Duration {
+	delay := jobRetryBaseDelay
+	for i := 1; i < attempts && delay < jobRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, jobRetryMaxDelay)
+}